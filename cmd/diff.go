@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/djskncxm/TraceParse/pkg/core"
+	"github.com/djskncxm/TraceParse/pkg/tui"
+)
+
+// runDiff 处理 diff 子命令：对齐两条 trace 并报告第一个分叉点
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	side := fs.Bool("tui", false, "Show both traces side by side")
+	limit := fs.Int("n", 20, "Maximum number of divergences to list")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s diff [options] a.log b.log\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	a, err := loadTrace(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := loadTrace(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	d, err := core.DiffTraces(a, b)
+	if err != nil {
+		return err
+	}
+
+	if *side {
+		return tui.RunDiff(d, a, b)
+	}
+	fmt.Print(d.Format(a, b, *limit))
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/djskncxm/TraceParse/pkg/core"
+)
+
+// loadTrace 读取 trace 及同目录下的 BL/RW 日志，日志不存在时跳过，读取失败时只给出警告
+func loadTrace(traceFile string) (*core.TraceManager, error) {
+	tm := core.NewTraceManager()
+	if err := core.ReadTraceFile(traceFile, tm); err != nil {
+		return nil, err
+	}
+	if blFile, rwFile, ok := core.CompanionLogs(traceFile); ok {
+		if err := tm.LogManager.LoadBLLog(blFile); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Warning: Could not load BL log: %v\n", err)
+		}
+		if err := tm.LogManager.LoadRWLog(rwFile); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Warning: Could not load RW log: %v\n", err)
+		}
+	}
+	return tm, nil
+}
+
+// writeOutput 把结果写入 path，path 为空时输出到标准输出
+func writeOutput(path, text string) error {
+	if path == "" {
+		_, err := fmt.Print(text)
+		return err
+	}
+	return os.WriteFile(path, []byte(text), 0644)
+}
+
+// runExport 处理 export-cfg / export-callgraph 子命令
+func runExport(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	format := fs.String("format", "", "Output format: dot or mermaid (default: by output extension, else dot)")
+	output := fs.String("o", "", "Output file (default: stdout)")
+	var function *string
+	if name == "export-cfg" {
+		function = fs.String("func", "", "Only export this function (name or entry address)")
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [options] trace.log\n", os.Args[0], name)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	kind, err := core.ExportFormat(*format, *output)
+	if err != nil {
+		return err
+	}
+	tm, err := loadTrace(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var text string
+	if name == "export-callgraph" {
+		cg, err := core.BuildCallGraph(tm)
+		if err != nil {
+			return err
+		}
+		if kind == "mermaid" {
+			text = cg.Mermaid()
+		} else {
+			text = cg.DOT()
+		}
+	} else {
+		g, err := tm.CFG()
+		if err != nil {
+			return err
+		}
+		var entry uint64
+		if *function != "" {
+			var ok bool
+			if entry, ok = g.FindFunction(*function); !ok {
+				return fmt.Errorf("function %q not found", *function)
+			}
+		}
+		if kind == "mermaid" {
+			text = g.Mermaid(entry)
+		} else {
+			text = g.DOT(entry)
+		}
+	}
+
+	if err := writeOutput(*output, text); err != nil {
+		return err
+	}
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", *output)
+	}
+	return nil
+}
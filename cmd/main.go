@@ -2,19 +2,64 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/djskncxm/TraceParse/pkg/core"
 	"github.com/djskncxm/TraceParse/pkg/tui"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
+	"os"
 )
 
+// subcommands 是 traceparse <name> 形式的子命令
+var subcommands = map[string]func(args []string) error{
+	"export-cfg":       func(args []string) error { return runExport("export-cfg", args) },
+	"export-callgraph": func(args []string) error { return runExport("export-callgraph", args) },
+	"stats":            runStats,
+	"diff":             runDiff,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	// 添加命令行参数解析
 	var traceFile string
 	flag.StringVar(&traceFile, "f", "", "Trace file to load")
 	flag.StringVar(&traceFile, "file", "", "Trace file to load")
+	var sessionFile string
+	flag.StringVar(&sessionFile, "session", "", "Session file to restore")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s [options]\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(out, "\nSubcommands:\n")
+		fmt.Fprintf(out, "  export-cfg [-format dot|mermaid] [-func name] [-o file] trace.log\n")
+		fmt.Fprintf(out, "  export-callgraph [-format dot|mermaid] [-o file] trace.log\n")
+		fmt.Fprintf(out, "  stats [-top N] trace.log\n")
+		fmt.Fprintf(out, "  diff [-tui] [-n N] a.log b.log\n")
+	}
 	flag.Parse()
 
+	// 会话文件中记录了 trace 路径
+	var session *core.Session
+	if sessionFile != "" {
+		var err error
+		if session, err = core.LoadSession(sessionFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading session: %v\n", err)
+			os.Exit(1)
+		}
+		if traceFile == "" {
+			traceFile = session.TraceFile
+		}
+	}
+
 	app := tview.NewApplication()
 
 	// 创建 TraceManager 和 User
@@ -24,8 +69,10 @@ func main() {
 	// 创建视图
 	asmView := tui.NewAsmView()
 	regView := tui.NewRegView()
+	backtraceView := tui.NewBacktraceView()
 	statusView := tui.NewStatusView()
 	memoryView := tui.NewMemoryView()
+	resultView := tui.NewResultView()
 
 	// 创建 BL 和 RW 视图
 	blView := tui.NewLogView("BL Log")
@@ -43,6 +90,9 @@ func main() {
 		BlView:       blView,
 		RwView:       rwView,
 		AutoStepChan: make(chan bool, 1),
+
+		BacktraceView: backtraceView,
+		ResultView:    resultView,
 	}
 
 	// 启动自动步进管理器
@@ -65,6 +115,11 @@ func main() {
 			cmd := user.ParseCommand("p")
 			tui.UpdateDisplay(state, cmd)
 			return nil
+		case tcell.KeyPgUp, tcell.KeyPgDn:
+			// 翻页：内存视图前后移动 0x100 字节
+			user.ScrollMemory(event.Key() == tcell.KeyPgUp, 0x100)
+			tui.UpdateMemoryView(state)
+			return nil
 		case tcell.KeyRune:
 			switch event.Rune() {
 			case 'q', 'Q':
@@ -85,18 +140,29 @@ func main() {
 		return event
 	})
 
+	// 寄存器视图右侧放调用栈
+	regPanel := tview.NewFlex().
+		AddItem(regView, 0, 3, false).
+		AddItem(backtraceView, 0, 2, false)
+
 	rightPanel := tview.NewFlex().
 		SetDirection(tview.FlexRow).
 		AddItem(statusView, 5, 1, false). // 状态视图：固定5行
-		AddItem(regView, 0, 2, false).    // 寄存器视图：动态高度，比例2
+		AddItem(regPanel, 0, 2, false).   // 寄存器 + 调用栈：动态高度，比例2
 		AddItem(blView, 0, 2, false).     // BL日志视图：动态高度，比例2
 		AddItem(rwView, 0, 2, false).     // RW日志视图：动态高度，比例2
 		AddItem(inputField, 3, 0, true)   // 输入框：固定3行
 
+	// 最右侧：内存视图在上，命令结果列表在下
+	sidePanel := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(memoryView, 0, 1, false).
+		AddItem(resultView, 0, 1, false)
+
 	root := tview.NewFlex().
 		AddItem(asmView, 0, 2, false).    // 汇编视图占3/5
 		AddItem(rightPanel, 0, 3, false). // 右侧面板占2/5
-		AddItem(memoryView, 0, 2, false)  // 内存视图：动态高度，比例2
+		AddItem(sidePanel, 0, 2, false)   // 内存 + 结果视图：动态高度，比例2
 
 	// 加载指令文件（与之前相同）
 	go func() {
@@ -118,6 +184,12 @@ func main() {
 					statusView.SetText("Error loading file: " + err.Error() +
 						"\nUsing example instructions...")
 				})
+			} else if session != nil {
+				app.QueueUpdateDraw(func() {
+					if err := tui.RestoreSession(state, session); err != nil {
+						statusView.SetText("Warning: " + err.Error())
+					}
+				})
 			}
 		}
 	}()
@@ -131,13 +203,55 @@ func main() {
 	run           - 自动向下执行 
 	s/stop        - 停止向下执 
 	step <ms>     - 设置自动执行间隔 
+	up/down [n]   - 切换调用帧并跳到调用点
+	/pat, ?pat    - 在整个 trace 中向后/向前搜索指令（支持正则）
+	/, N          - 重复上一次搜索 / 反方向重复
+	findval <v> [reg] - 查找寄存器持有某值（或 lo-hi 区间）的位置
+	mark <name>   - 为当前行添加书签，'name 跳转，marks 列出
+	note <name> <text> - 为书签添加备注（unmark 删除书签）
+	session save <file> - 保存会话（traceparse --session <file> 恢复）
+	mem [addr|+n|-n] - 内存视图定位（PgUp/PgDn 翻页，无参数跟随读写）
+	x/NFU <expr>  - 查看内存，如 x/32xb 0x7fda1a4228、x/4gx $sp、x/s $x0
+	history <addr> [len] - 列出整个 trace 中对该地址范围的读写
+	history next/prev - 跳到上一次 history 结果中的下一次 / 上一次访问
+	memdiff <stepA> <stepB> [range] - 并排比较两步之间的内存
+	vmmap         - 显示由 trace 推断出的内存区域（加载后在后台推断，寄存器值按区域着色）
+	dump memory <file> <start> <end> [@step] - 导出重建的内存（附 .mask 未知字节掩码）
+	taint <reg>... - 从当前行开始污染寄存器并向后传播（被污染的指令和寄存器以橙色显示）
+	taint mem <start> <len> - 从当前行开始污染一段内存
+	taint clear   - 清除污点
+	slice <reg>   - 当前行寄存器值的后向数据流切片（切片中的指令以青色显示）
+	slice next/prev/clear - 在切片中前后跳转 / 清除切片
+	origin <reg>  - 跳到当前行之前最后一次改变该寄存器的指令，再次输入 origin 沿源寄存器继续回溯
+	uses <reg>    - 列出从当前行开始读取该寄存器的指令，直到它被覆盖
+	cfg [func]    - 显示函数（默认为当前函数）的动态控制流图及边的执行次数
+	cfg [func] export <file> - 导出控制流图（.mmd 为 Mermaid，其余为 Graphviz DOT）
+	loops         - 列出检测到的循环（地址序列周期性重复的区间）
+	fold [all]    - 在汇编视图中把当前（或全部）循环折叠成一行
+	unfold [all]  - 展开当前（或全部）循环
+	until, u      - 跳过当前循环，停在循环退出后的第一条指令
+	filter addr <range>[,<range>] - 只显示地址在范围内的指令（0x1000-0x5000 或 0x1000+0x100）
+	filter mnemonic <m>[,<m>] - 只显示这些助记符的指令
+	filter module [base|name] - 只显示某模块（基址见 vmmap，默认为当前模块）的指令
+	              name 只能是 BL 日志中的函数名或 "模块!函数" 中的模块名，trace 本身不记录模块名
+	filter -addr/-mnemonic/-module ... - 隐藏匹配的指令；多条规则同时生效
+	filter [clear] - 列出或清除过滤规则；移动和跳转都只停在可见的指令上
+	vm [dispatcher] - 识别虚拟机分发器（默认为执行最多的间接跳转）并列出处理函数
+	vm view       - 切换汇编视图按处理函数调用显示（此时 n/p 按分发前进后退）
+	vm next/prev [handler] - 跳到下一次 / 上一次（某个处理函数的）调用，vm clear 清除
+	crypto        - 在立即数、寄存器值和读写的内存中查找 AES/SHA/MD5/CRC32/ChaCha/TEA 等算法常量
+	crypto next/prev - 跳到下一处 / 上一处用到算法常量的指令
+	stats [N]     - 执行统计：热点地址、助记符分布、各函数指令数、覆盖率（每项列出前 N 个）
+	h, help       - 显示本帮助
 	"]"           - 重复上一个命令 
 	q, quit       - 退出
 	
   面板现在有一个bug，必须按一个键位才会显示文件，我也不知道为啥，还在排查
 	`
 
-	memoryView.SetText(helpText)
+	// 帮助信息显示在结果面板，h/help 可以再次打开
+	user.HelpText = helpText
+	resultView.SetText(helpText).SetTitle("|Help|")
 
 	// 运行应用
 	if err := app.SetRoot(root, true).
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/djskncxm/TraceParse/pkg/core"
+)
+
+// runStats 处理 stats 子命令：输出 trace 的执行统计
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	top := fs.Int("top", 20, "Number of entries in each ranking")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s stats [options] trace.log\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	tm, err := loadTrace(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	stats, err := core.BuildStats(tm)
+	if err != nil {
+		return err
+	}
+	fmt.Print(stats.Format(*top))
+	return nil
+}
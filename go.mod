@@ -2,11 +2,14 @@ module github.com/djskncxm/TraceParse
 
 go 1.25.5
 
-require github.com/rivo/tview v0.42.0
+require (
+	github.com/gdamore/tcell/v2 v2.8.1
+	github.com/rivo/tview v0.42.0
+	golang.org/x/arch v0.22.0
+)
 
 require (
 	github.com/gdamore/encoding v1.0.1 // indirect
-	github.com/gdamore/tcell/v2 v2.8.1 // indirect
 	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
 	github.com/mattn/go-runewidth v0.0.16 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// Bookmark 是用户标记的一行，可以附带备注
+type Bookmark struct {
+	Name  string `json:"name"`
+	Index int    `json:"index"`
+	Step  uint32 `json:"step"`
+	Addr  uint64 `json:"addr"`
+	Note  string `json:"note,omitempty"`
+}
+
+// BookmarkStore 保存某个 trace 的书签
+// 书签持久化在 trace 旁边的 sidecar 文件里，按 trace 内容的哈希区分，trace 被替换后旧书签不会误用
+type BookmarkStore struct {
+	Path  string // sidecar 文件路径，为空时不持久化
+	Hash  string // trace 内容的 sha256
+	Marks []*Bookmark
+}
+
+// sidecarEntry 是 sidecar 文件中某个 trace 哈希对应的内容
+type sidecarEntry struct {
+	Bookmarks []*Bookmark `json:"bookmarks"`
+}
+
+// SidecarPath 返回 trace 文件对应的 sidecar 路径
+func SidecarPath(traceFile string) string {
+	return traceFile + ".traceparse.json"
+}
+
+// TraceHash 计算 trace 文件内容的 sha256
+func TraceHash(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func readSidecar(path string) (map[string]*sidecarEntry, error) {
+	entries := make(map[string]*sidecarEntry)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// LoadBookmarks 读取 trace 对应的书签，sidecar 不存在时返回空集合
+func LoadBookmarks(traceFile string) (*BookmarkStore, error) {
+	hash, err := TraceHash(traceFile)
+	if err != nil {
+		return &BookmarkStore{}, err
+	}
+
+	bs := &BookmarkStore{Path: SidecarPath(traceFile), Hash: hash}
+	entries, err := readSidecar(bs.Path)
+	if err != nil {
+		return bs, err
+	}
+	if entry := entries[hash]; entry != nil {
+		bs.Marks = entry.Bookmarks
+	}
+	bs.sort()
+	return bs, nil
+}
+
+// Save 写回 sidecar 文件，保留其他 trace 哈希下的内容
+func (bs *BookmarkStore) Save() error {
+	if bs.Path == "" {
+		return nil
+	}
+	entries, err := readSidecar(bs.Path)
+	if err != nil {
+		return err
+	}
+	entries[bs.Hash] = &sidecarEntry{Bookmarks: bs.Marks}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(bs.Path, data, 0644)
+}
+
+func (bs *BookmarkStore) sort() {
+	sort.SliceStable(bs.Marks, func(i, j int) bool {
+		return bs.Marks[i].Index < bs.Marks[j].Index
+	})
+}
+
+// Get 按名称查找书签
+func (bs *BookmarkStore) Get(name string) *Bookmark {
+	for _, m := range bs.Marks {
+		if m.Name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// At 返回第 index 行上的书签
+func (bs *BookmarkStore) At(index int) *Bookmark {
+	for _, m := range bs.Marks {
+		if m.Index == index {
+			return m
+		}
+	}
+	return nil
+}
+
+// Set 在 ref 处创建书签，同名书签会被移动过去（保留备注）
+func (bs *BookmarkStore) Set(name string, ref LineRef) *Bookmark {
+	m := bs.Get(name)
+	if m == nil {
+		m = &Bookmark{Name: name}
+		bs.Marks = append(bs.Marks, m)
+	}
+	m.Index = ref.Index
+	m.Step = ref.Step
+	m.Addr = ref.Addr
+	bs.sort()
+	return m
+}
+
+// Remove 删除书签，返回是否存在
+func (bs *BookmarkStore) Remove(name string) bool {
+	for i, m := range bs.Marks {
+		if m.Name == name {
+			bs.Marks = append(bs.Marks[:i], bs.Marks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CallFrame 表示一次由 bl/blr 建立的调用帧
+type CallFrame struct {
+	CallIndex  int    // 调用指令所在行
+	CallStep   uint32 // 调用指令的 step
+	CallAddr   uint64 // 调用指令地址
+	Target     uint64 // 被调函数入口
+	ReturnAddr uint64 // 进入被调函数时 x30 中保存的返回地址
+	SP         uint64 // 调用时的 SP，返回后应恢复为该值
+	RetIndex   int    // 对应 ret 所在行，-1 表示直到 trace 结束都没有返回
+	Function   string // BL 日志中的函数名，可能为空
+
+	parent int // 外层帧在 frames 中的下标，-1 表示最外层
+}
+
+// Name 返回帧对应函数的显示名
+func (f *CallFrame) Name() string {
+	if f.Function != "" {
+		return f.Function
+	}
+	if f.Target != 0 {
+		return fmt.Sprintf("sub_%x", f.Target)
+	}
+	return "??"
+}
+
+// CallStack 根据 bl/blr 与 ret 重建的影子调用栈
+type CallStack struct {
+	frames []*CallFrame // 按 CallIndex 递增
+}
+
+// BuildCallStack 扫描整个 trace 重建调用关系
+// ret（或 longjmp 之类的间接跳转）的目的地址等于栈中某帧保存的 x30、且 SP 恢复为该帧调用时的值时，
+// 弹出该帧及其内层帧；尾调用、跳过的返回留下的内层帧随之一起弹出
+func BuildCallStack(tm *TraceManager) (*CallStack, error) {
+	cs := &CallStack{}
+	var open []int
+
+	pendingCall := -1
+	pendingRet := -1
+	var pendingDest, pendingSP uint64
+
+	unwind := func(retIndex int, dest, sp uint64) {
+		for d := len(open) - 1; d >= 0; d-- {
+			f := cs.frames[open[d]]
+			// SP 为 0 表示 trace 中没有记录 SP，只比较返回地址
+			if f.ReturnAddr != dest || f.SP != 0 && sp != 0 && f.SP != sp {
+				continue
+			}
+			for _, fi := range open[d:] {
+				cs.frames[fi].RetIndex = retIndex
+			}
+			open = open[:d]
+			return
+		}
+	}
+
+	err := tm.Scan(func(index int, t *TraceLine) bool {
+		if pendingCall != -1 {
+			f := cs.frames[pendingCall]
+			f.Target = t.Addr
+			if t.Regs[30] != 0 {
+				f.ReturnAddr = t.Regs[30]
+			}
+			pendingCall = -1
+		}
+		if pendingRet != -1 {
+			unwind(pendingRet, t.Addr, t.SP)
+			pendingRet = -1
+		}
+
+		d := t.Decode()
+		switch {
+		case d.Call:
+			parent := -1
+			if len(open) > 0 {
+				parent = open[len(open)-1]
+			}
+			cs.frames = append(cs.frames, &CallFrame{
+				CallIndex:  index,
+				CallStep:   t.Step,
+				CallAddr:   t.Addr,
+				ReturnAddr: t.Addr + 4,
+				SP:         t.SP,
+				RetIndex:   -1,
+				parent:     parent,
+			})
+			pendingCall = len(cs.frames) - 1
+			open = append(open, pendingCall)
+		case d.Return || isIndirectBranch(d):
+			// 目的地址以下一行为准，trace 在这里结束时用跳转寄存器的值
+			pendingRet = index
+			pendingDest, pendingSP = t.Regs[30], t.SP
+			if len(d.Operands) > 0 && d.Operands[0].Reg >= 0 {
+				pendingDest = t.RegisterValue(d.Operands[0].Reg)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// trace 以 ret 结尾时没有下一行，只能相信跳转寄存器
+	if pendingRet != -1 {
+		unwind(pendingRet, pendingDest, pendingSP)
+	}
+
+	cs.attachNames(tm.LogManager)
+	return cs, nil
+}
+
+// attachNames 用 BL 日志中的函数名标注调用帧
+func (cs *CallStack) attachNames(lm *LogManager) {
+	if lm == nil || len(lm.BlLogs) == 0 {
+		return
+	}
+
+	byAddr := make(map[uint64]string)
+	for _, logs := range lm.BlLogs {
+		for _, log := range logs {
+			if log.Function == "" {
+				continue
+			}
+			if addr, err := strconv.ParseUint(strings.TrimSpace(log.Address), 0, 64); err == nil {
+				byAddr[addr] = log.Function
+			}
+		}
+	}
+
+	for _, f := range cs.frames {
+		// 优先使用调用指令（或其下一步）上记录的跳转日志
+		for _, step := range []int{int(f.CallStep), int(f.CallStep) + 1} {
+			for _, log := range lm.BlLogs[step] {
+				if log.Function != "" {
+					f.Function = log.Function
+					break
+				}
+			}
+			if f.Function != "" {
+				break
+			}
+		}
+		if f.Function == "" {
+			f.Function = byAddr[f.Target]
+		}
+	}
+}
+
+// At 返回第 index 行执行时处于活动状态的调用帧，从最外层到最内层
+func (cs *CallStack) At(index int) []*CallFrame {
+	// 最后一个在 index 之前发生的调用
+	i := sort.Search(len(cs.frames), func(i int) bool {
+		return cs.frames[i].CallIndex >= index
+	}) - 1
+
+	var stack []*CallFrame
+	for i >= 0 {
+		f := cs.frames[i]
+		if f.RetIndex == -1 || f.RetIndex >= index {
+			stack = append(stack, f)
+		}
+		i = f.parent
+	}
+
+	// 反转为外层在前
+	for l, r := 0, len(stack)-1; l < r; l, r = l+1, r-1 {
+		stack[l], stack[r] = stack[r], stack[l]
+	}
+	return stack
+}
+
+// Frames 返回所有调用帧
+func (cs *CallStack) Frames() []*CallFrame {
+	return cs.frames
+}
+
+// CallStack 返回（必要时构建）影子调用栈
+func (tm *TraceManager) CallStack() (*CallStack, error) {
+	if tm.callStack != nil {
+		return tm.callStack, nil
+	}
+	cs, err := BuildCallStack(tm)
+	if err != nil {
+		return nil, err
+	}
+	tm.callStack = cs
+	return cs, nil
+}
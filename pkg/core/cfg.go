@@ -0,0 +1,267 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BasicBlock 是执行过的一段连续指令：只能从第一条进入，最后一条是分支或控制流不连续之前的指令
+type BasicBlock struct {
+	Start      uint64
+	End        uint64   // 最后一条指令的地址
+	Instrs     []string // 第一次执行时的指令文本
+	Count      int      // 执行次数
+	Function   uint64   // 所属函数入口
+	FirstIndex int      // 第一次执行时所在的行
+}
+
+// CFGEdge 是两个基本块之间实际走过的边
+type CFGEdge struct {
+	From  uint64
+	To    uint64
+	Count int
+}
+
+// EdgeSet 按 (From, To) 索引的边
+type EdgeSet map[[2]uint64]*CFGEdge
+
+// add 把 from -> to 的执行次数加一
+func (s EdgeSet) add(from, to uint64) {
+	key := [2]uint64{from, to}
+	e := s[key]
+	if e == nil {
+		e = &CFGEdge{From: from, To: to}
+		s[key] = e
+	}
+	e.Count++
+}
+
+// Sorted 返回按 (From, To) 排序的边
+func (s EdgeSet) Sorted() []*CFGEdge {
+	edges := make([]*CFGEdge, 0, len(s))
+	for _, e := range s {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	return edges
+}
+
+// CFG 是由 trace 恢复出的动态控制流图
+// 调用不算作边：调用块直接连到返回后执行的块，被调函数单独成图，调用关系另记在 Calls 中
+type CFG struct {
+	Blocks    map[uint64]*BasicBlock // 按起始地址索引
+	Edges     EdgeSet
+	Calls     EdgeSet           // 调用块 -> 被调函数入口块
+	Functions map[uint64]string // 函数入口 -> 名称
+	Root      uint64            // trace 顶层（第一行所在函数）的入口
+}
+
+// BuildCFG 扫描两遍 trace：第一遍找出块首（trace 开头、分支之后、地址不连续处），
+// 第二遍切分基本块并按调用帧统计边
+func BuildCFG(tm *TraceManager) (*CFG, error) {
+	cs, err := tm.CallStack()
+	if err != nil {
+		return nil, err
+	}
+
+	leaders := make(map[uint64]bool)
+	var prev *TraceLine
+	err = tm.Scan(func(index int, t *TraceLine) bool {
+		if prev == nil || prev.Decode().Branch || t.Addr != prev.Addr+4 {
+			leaders[t.Addr] = true
+		}
+		prev = t
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	g := &CFG{
+		Blocks:    make(map[uint64]*BasicBlock),
+		Edges:     make(EdgeSet),
+		Calls:     make(EdgeSet),
+		Functions: make(map[uint64]string),
+	}
+	last := make(map[*CallFrame]*BasicBlock) // 每个调用帧中最近执行的块，nil 键为 trace 顶层
+	var current *BasicBlock
+	recording := false
+	prev = nil
+
+	err = tm.Scan(func(index int, t *TraceLine) bool {
+		if prev == nil {
+			g.Root = t.Addr
+			g.Functions[g.Root] = fmt.Sprintf("sub_%x", g.Root)
+		}
+		if prev != nil && !prev.Decode().Branch && t.Addr == prev.Addr+4 && !leaders[t.Addr] {
+			// 块内的下一条指令
+			if recording {
+				current.End = t.Addr
+				current.Instrs = append(current.Instrs, t.Instr)
+			}
+			prev = t
+			return true
+		}
+
+		var frame, caller *CallFrame
+		entry := g.Root
+		frames := cs.At(index)
+		if n := len(frames); n > 0 {
+			frame = frames[n-1]
+			entry = frame.Target
+			g.Functions[entry] = frame.Name()
+			if n > 1 {
+				caller = frames[n-2]
+			}
+		}
+
+		b := g.Blocks[t.Addr]
+		recording = b == nil
+		if b == nil {
+			b = &BasicBlock{Start: t.Addr, End: t.Addr, Instrs: []string{t.Instr}, Function: entry, FirstIndex: index}
+			g.Blocks[t.Addr] = b
+		}
+		b.Count++
+
+		if from := last[frame]; from != nil {
+			g.Edges.add(from.Start, b.Start)
+		} else if from := last[caller]; frame != nil && from != nil {
+			// 被调函数的第一个块
+			g.Calls.add(from.Start, b.Start)
+		}
+		last[frame] = b
+		current = b
+		prev = t
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// FunctionGraph 是 CFG 中属于同一个函数的部分
+type FunctionGraph struct {
+	Entry  uint64
+	Name   string
+	Blocks []*BasicBlock // 按地址排序
+	Edges  []*CFGEdge    // 按 (From, To) 排序
+}
+
+// FindFunction 按名称或入口地址查找函数
+func (g *CFG) FindFunction(name string) (uint64, bool) {
+	for entry, n := range g.Functions {
+		if n == name {
+			return entry, true
+		}
+	}
+	if addr, err := strconv.ParseUint(strings.TrimPrefix(name, "sub_"), 16, 64); err == nil {
+		if _, ok := g.Functions[addr]; ok {
+			return addr, true
+		}
+	}
+	if addr, err := strconv.ParseUint(name, 0, 64); err == nil {
+		if _, ok := g.Functions[addr]; ok {
+			return addr, true
+		}
+	}
+	return 0, false
+}
+
+// Function 返回入口为 entry 的函数的子图
+func (g *CFG) Function(entry uint64) *FunctionGraph {
+	fg := &FunctionGraph{Entry: entry, Name: g.Functions[entry]}
+	for _, b := range g.Blocks {
+		if b.Function == entry {
+			fg.Blocks = append(fg.Blocks, b)
+		}
+	}
+	sort.Slice(fg.Blocks, func(i, j int) bool { return fg.Blocks[i].Start < fg.Blocks[j].Start })
+
+	for _, e := range g.Edges.Sorted() {
+		if g.Blocks[e.From].Function == entry && g.Blocks[e.To].Function == entry {
+			fg.Edges = append(fg.Edges, e)
+		}
+	}
+	return fg
+}
+
+// blockIDs 按地址顺序给块编号 B0、B1...
+func (fg *FunctionGraph) blockIDs() map[uint64]string {
+	ids := make(map[uint64]string, len(fg.Blocks))
+	for i, b := range fg.Blocks {
+		ids[b.Start] = fmt.Sprintf("B%d", i)
+	}
+	return ids
+}
+
+// Render 以文本框的形式画出函数的 CFG，每个块下方列出出边及执行次数，回边标记为 (loop)
+func (fg *FunctionGraph) Render() string {
+	ids := fg.blockIDs()
+	out := make(map[uint64][]*CFGEdge)
+	in := make(map[uint64][]*CFGEdge)
+	for _, e := range fg.Edges {
+		out[e.From] = append(out[e.From], e)
+		in[e.To] = append(in[e.To], e)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s (entry 0x%x): %d blocks, %d edges\n\n", fg.Name, fg.Entry, len(fg.Blocks), len(fg.Edges)))
+	for _, b := range fg.Blocks {
+		header := fmt.Sprintf("+-- %s  0x%x  x%d", ids[b.Start], b.Start, b.Count)
+		if b.Start == fg.Entry {
+			header += "  [entry]"
+		}
+		if len(in[b.Start]) > 0 {
+			var preds []string
+			for _, e := range in[b.Start] {
+				preds = append(preds, ids[e.From])
+			}
+			header += "  <- " + strings.Join(preds, ", ")
+		}
+		sb.WriteString(header + "\n")
+
+		addr := b.Start
+		for _, instr := range b.Instrs {
+			sb.WriteString(fmt.Sprintf("|  0x%x  %s\n", addr, instr))
+			addr += 4
+		}
+
+		edges := out[b.Start]
+		sort.Slice(edges, func(i, j int) bool { return edges[i].Count > edges[j].Count })
+		if len(edges) == 0 {
+			sb.WriteString("+-> (exit)\n\n")
+			continue
+		}
+		var succ []string
+		for _, e := range edges {
+			s := fmt.Sprintf("%s x%d", ids[e.To], e.Count)
+			if e.To <= e.From {
+				s += " (loop)"
+			}
+			succ = append(succ, s)
+		}
+		sb.WriteString("+-> " + strings.Join(succ, ", ") + "\n\n")
+	}
+	return sb.String()
+}
+
+// CFG 返回（必要时构建）动态控制流图
+func (tm *TraceManager) CFG() (*CFG, error) {
+	if tm.cfg != nil {
+		return tm.cfg, nil
+	}
+	g, err := BuildCFG(tm)
+	if err != nil {
+		return nil, err
+	}
+	tm.cfg = g
+	return g, nil
+}
@@ -0,0 +1,88 @@
+package core
+
+import "testing"
+
+func TestBuildCFG(t *testing.T) {
+	// 顶层调用一次 0x2000，返回后 0x1008 处的循环执行三次
+	tm := NewTraceManager()
+	for i, l := range []struct {
+		addr  uint64
+		instr string
+	}{
+		{0x1000, "mov x0, #3"},
+		{0x1004, "bl #0x2000"},
+		{0x2000, "ret"},
+		{0x1008, "subs x0, x0, #1"},
+		{0x100c, "b.ne #0x1008"},
+		{0x1008, "subs x0, x0, #1"},
+		{0x100c, "b.ne #0x1008"},
+		{0x1008, "subs x0, x0, #1"},
+		{0x100c, "b.ne #0x1008"},
+		{0x1010, "nop"},
+	} {
+		line := &TraceLine{Step: uint32(i), Addr: l.addr, Offset: l.addr, Instr: l.instr, SP: 0x7fff0000}
+		if l.addr == 0x2000 {
+			line.Regs[30] = 0x1008
+		}
+		tm.AddInstruction(line)
+	}
+
+	g, err := BuildCFG(tm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := map[uint64]struct {
+		end      uint64
+		count    int
+		function uint64
+	}{
+		0x1000: {0x1004, 1, 0x1000},
+		0x2000: {0x2000, 1, 0x2000},
+		0x1008: {0x100c, 3, 0x1000},
+		0x1010: {0x1010, 1, 0x1000},
+	}
+	if len(g.Blocks) != len(blocks) {
+		t.Errorf("got %d blocks, want %d", len(g.Blocks), len(blocks))
+	}
+	for start, want := range blocks {
+		b := g.Blocks[start]
+		if b == nil {
+			t.Errorf("block 0x%x missing", start)
+			continue
+		}
+		if b.End != want.end || b.Count != want.count || b.Function != want.function {
+			t.Errorf("block 0x%x: end 0x%x count %d function 0x%x, want 0x%x %d 0x%x",
+				start, b.End, b.Count, b.Function, want.end, want.count, want.function)
+		}
+	}
+
+	checkEdges := func(name string, set EdgeSet, want []CFGEdge) {
+		got := set.Sorted()
+		if len(got) != len(want) {
+			t.Errorf("%s: got %d edges, want %d", name, len(got), len(want))
+			return
+		}
+		for i := range want {
+			if *got[i] != want[i] {
+				t.Errorf("%s %d: got %+v, want %+v", name, i, *got[i], want[i])
+			}
+		}
+	}
+	// 调用块直接连到返回后的块，循环的回边执行两次
+	checkEdges("edges", g.Edges, []CFGEdge{
+		{From: 0x1000, To: 0x1008, Count: 1},
+		{From: 0x1008, To: 0x1008, Count: 2},
+		{From: 0x1008, To: 0x1010, Count: 1},
+	})
+	checkEdges("calls", g.Calls, []CFGEdge{
+		{From: 0x1000, To: 0x2000, Count: 1},
+	})
+
+	if g.Root != 0x1000 {
+		t.Errorf("root 0x%x, want 0x1000", g.Root)
+	}
+	if entry, ok := g.FindFunction("sub_2000"); !ok || entry != 0x2000 {
+		t.Errorf("FindFunction(sub_2000) = 0x%x, %v", entry, ok)
+	}
+}
@@ -0,0 +1,269 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// cryptoConstant 是一个能标识算法的常量
+type cryptoConstant struct {
+	Algorithm string
+	Name      string
+}
+
+// cryptoWords 按 32 位值索引的算法常量
+var cryptoWords = map[uint32]cryptoConstant{}
+
+// cryptoPatterns 是按字节序列匹配的常量（表格开头、字符串）
+var cryptoPatterns = []struct {
+	cryptoConstant
+	Bytes []byte
+}{
+	{cryptoConstant{"AES", "S-box"}, []byte{0x63, 0x7c, 0x77, 0x7b, 0xf2, 0x6b, 0x6f, 0xc5, 0x30, 0x01, 0x67, 0x2b}},
+	{cryptoConstant{"AES", "inverse S-box"}, []byte{0x52, 0x09, 0x6a, 0xd5, 0x30, 0x36, 0xa5, 0x38, 0xbf, 0x40, 0xa3, 0x9e}},
+	{cryptoConstant{"ChaCha/Salsa20", `"expand 32-byte k"`}, []byte("expand 32-byte k")},
+	{cryptoConstant{"ChaCha/Salsa20", `"expand 16-byte k"`}, []byte("expand 16-byte k")},
+}
+
+func init() {
+	add := func(algorithm, name string, values ...uint32) {
+		for i, v := range values {
+			n := name
+			if len(values) > 1 {
+				n = fmt.Sprintf("%s[%d]", name, i)
+			}
+			cryptoWords[v] = cryptoConstant{algorithm, n}
+		}
+	}
+	add("AES", "S-box word", 0x7b777c63)
+	add("AES", "inverse S-box word", 0xd56a0952)
+	add("AES", "Te0[0]", 0xc66363a5)
+	add("AES", "Te0[0] (LE)", 0xa56363c6)
+	add("SHA-256", "K",
+		0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+		0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+		0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+		0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+		0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+		0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+		0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+		0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2)
+	add("SHA-256", "H", 0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19)
+	// MD5 与 SHA-1 的初始值前四个相同
+	add("MD5/SHA-1", "init", 0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476)
+	add("SHA-1", "H4", 0xc3d2e1f0)
+	add("SHA-1", "K", 0x5a827999, 0x6ed9eba1, 0x8f1bbcdc, 0xca62c1d6)
+	add("MD5", "T",
+		0xd76aa478, 0xe8c7b756, 0x242070db, 0xc1bdceee, 0xf57c0faf, 0x4787c62a, 0xa8304613, 0xfd469501,
+		0x698098d8, 0x8b44f7af, 0xffff5bb1, 0x895cd7be, 0x6b901122, 0xfd987193, 0xa679438e, 0x49b40821,
+		0xf61e2562, 0xc040b340, 0x265e5a51, 0xe9b6c7aa, 0xd62f105d, 0x02441453, 0xd8a1e681, 0xe7d3fbc8,
+		0x21e1cde6, 0xc33707d6, 0xf4d50d87, 0x455a14ed, 0xa9e3e905, 0xfcefa3f8, 0x676f02d9, 0x8d2a4c8a,
+		0xfffa3942, 0x8771f681, 0x6d9d6122, 0xfde5380c, 0xa4beea44, 0x4bdecfa9, 0xf6bb4b60, 0xbebfbc70,
+		0x289b7ec6, 0xeaa127fa, 0xd4ef3085, 0x04881d05, 0xd9d4d039, 0xe6db99e5, 0x1fa27cf8, 0xc4ac5665,
+		0xf4292244, 0x432aff97, 0xab9423a7, 0xfc93a039, 0x655b59c3, 0x8f0ccc92, 0xffeff47d, 0x85845dd1,
+		0x6fa87e4f, 0xfe2ce6e0, 0xa3014314, 0x4e0811a1, 0xf7537e82, 0xbd3af235, 0x2ad7d2bb, 0xeb86d391)
+	add("CRC32", "polynomial (reflected)", 0xedb88320)
+	add("CRC32", "polynomial", 0x04c11db7)
+	add("CRC32C", "polynomial (reflected)", 0x82f63b78)
+	add("ChaCha/Salsa20", "sigma", 0x61707865, 0x3320646e, 0x79622d32, 0x6b206574)
+	add("TEA/XTEA", "delta", 0x9e3779b9)
+	add("TEA/XTEA", "delta×32", 0xc6ef3720)
+	add("TEA/XTEA", "-delta", 0x61c88647)
+}
+
+// lookupCrypto 查找 64 位值中的常量：高低两个 32 位分别匹配（寄存器里可能装着两个相邻的表项）
+func lookupCrypto(v uint64) []cryptoConstant {
+	var found []cryptoConstant
+	if c, ok := cryptoWords[uint32(v)]; ok {
+		found = append(found, c)
+	}
+	if hi := uint32(v >> 32); hi != uint32(v) {
+		if c, ok := cryptoWords[hi]; ok {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+// CryptoHit 是某个常量在 trace 中的一处出现，同一条指令以同一种方式用到同一个常量的多次执行合并为一项
+type CryptoHit struct {
+	cryptoConstant
+	Source     string // "imm"、"reg xN" 或 "mem 0x..."
+	Addr       uint64 // 指令地址
+	Instr      string
+	Function   string
+	FirstIndex int
+	FirstStep  uint32
+	Count      int
+}
+
+// CryptoReport 是 crypto 扫描的结果
+type CryptoReport struct {
+	Hits []*CryptoHit // 按第一次出现的行排序
+}
+
+// ScanCrypto 在指令立即数、寄存器值和 RW 日志转储的内存中查找已知的密码算法常量
+// 寄存器值在发生变化时归到写入它的上一条指令，内存中的同一地址只在第一次出现时记录
+func ScanCrypto(tm *TraceManager) (*CryptoReport, error) {
+	cs, err := tm.CallStack()
+	if err != nil {
+		return nil, err
+	}
+
+	type hitKey struct {
+		name   string
+		addr   uint64
+		source string
+	}
+	hits := make(map[hitKey]*CryptoHit)
+	report := &CryptoReport{}
+	root := "" // trace 顶层没有调用帧，用第一行所在的函数
+	record := func(c cryptoConstant, index int, t *TraceLine, source string) {
+		key := hitKey{c.Algorithm + " " + c.Name, t.Addr, source}
+		h := hits[key]
+		if h == nil {
+			name := root
+			if frames := cs.At(index); len(frames) > 0 {
+				name = frames[len(frames)-1].Name()
+			}
+			h = &CryptoHit{cryptoConstant: c, Source: source, Addr: t.Addr, Instr: t.Instr, Function: name, FirstIndex: index, FirstStep: t.Step}
+			hits[key] = h
+			report.Hits = append(report.Hits, h)
+		}
+		h.Count++
+	}
+
+	seenMem := make(map[uint64]bool)
+	var prev *TraceLine
+	prevIndex := -1
+	err = tm.Scan(func(index int, t *TraceLine) bool {
+		if root == "" {
+			root = fmt.Sprintf("sub_%x", t.Addr)
+		}
+		for _, op := range t.Decode().Operands {
+			if op.IsImm {
+				for _, c := range lookupCrypto(uint64(op.Imm)) {
+					record(c, index, t, "imm")
+				}
+			}
+		}
+
+		// 寄存器中新出现的值，归到上一条解析成功的指令（不一定是 index-1）
+		if prev != nil {
+			for r := 0; r < 31; r++ {
+				if v := t.Regs[r]; v != prev.Regs[r] {
+					for _, c := range lookupCrypto(v) {
+						record(c, prevIndex, prev, fmt.Sprintf("reg x%d", r))
+					}
+				}
+			}
+		}
+		prev, prevIndex = t, index
+
+		// 这一步读写时转储的内存，连续的行拼在一起扫描，跨行的字节序列也能匹配
+		found := func(c cryptoConstant, at uint64) {
+			record(c, index, t, fmt.Sprintf("mem 0x%x", at))
+		}
+		for _, log := range tm.LogManager.RwLogs[int(t.Step)] {
+			base, next := log.EffectiveAddress(), log.EffectiveAddress()
+			var block []byte
+			for _, line := range log.MemoryHex {
+				addr, data, hasAddr, ok := ParseHexdumpLine(line)
+				if !ok {
+					continue
+				}
+				if hasAddr && addr != next {
+					scanMemory(base, block, seenMem, found)
+					base, block = addr, nil
+				}
+				block = append(block, data...)
+				next = base + uint64(len(block))
+			}
+			scanMemory(base, block, seenMem, found)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(report.Hits, func(i, j int) bool { return report.Hits[i].FirstIndex < report.Hits[j].FirstIndex })
+	return report, nil
+}
+
+// scanMemory 在一段连续的转储中查找对齐的 32 位常量和字节序列，每个地址只报告一次
+func scanMemory(base uint64, data []byte, seen map[uint64]bool, found func(c cryptoConstant, at uint64)) {
+	for i := 0; i+4 <= len(data); i++ {
+		at := base + uint64(i)
+		if at%4 != 0 || seen[at] {
+			continue
+		}
+		if c, ok := cryptoWords[binary.LittleEndian.Uint32(data[i:])]; ok {
+			seen[at] = true
+			found(c, at)
+		}
+	}
+	for _, p := range cryptoPatterns {
+		if i := bytes.Index(data, p.Bytes); i >= 0 {
+			at := base + uint64(i)
+			if !seen[at] {
+				seen[at] = true
+				found(p.cryptoConstant, at)
+			}
+		}
+	}
+}
+
+// Lines 返回所有命中第一次出现的行，按行号排序、去重
+func (r *CryptoReport) Lines() []int {
+	seen := make(map[int]bool)
+	var lines []int
+	for _, h := range r.Hits {
+		if !seen[h.FirstIndex] {
+			seen[h.FirstIndex] = true
+			lines = append(lines, h.FirstIndex)
+		}
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Format 按算法分组列出命中的常量、所在函数和位置
+func (r *CryptoReport) Format() string {
+	groups := make(map[string][]*CryptoHit)
+	var algorithms []string
+	for _, h := range r.Hits {
+		if groups[h.Algorithm] == nil {
+			algorithms = append(algorithms, h.Algorithm)
+		}
+		groups[h.Algorithm] = append(groups[h.Algorithm], h)
+	}
+
+	var sb strings.Builder
+	for _, alg := range algorithms {
+		hs := groups[alg]
+		names := make(map[string]bool)
+		funcs := make(map[string]bool)
+		var nameList, funcList []string
+		for _, h := range hs {
+			if !names[h.Name] {
+				names[h.Name] = true
+				nameList = append(nameList, h.Name)
+			}
+			if !funcs[h.Function] {
+				funcs[h.Function] = true
+				funcList = append(funcList, h.Function)
+			}
+		}
+		sb.WriteString(fmt.Sprintf("%s: %d constants in %s\n", alg, len(nameList), strings.Join(funcList, ", ")))
+		sb.WriteString(fmt.Sprintf("  %s\n", strings.Join(nameList, ", ")))
+		for _, h := range hs {
+			sb.WriteString(fmt.Sprintf("  %5d  step %-6d 0x%x  %-24s %-16s x%-5d %s\n",
+				h.FirstIndex, h.FirstStep, h.Addr, h.Instr, h.Source, h.Count, h.Name))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
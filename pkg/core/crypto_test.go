@@ -0,0 +1,119 @@
+package core
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestCryptoTables(t *testing.T) {
+	counts := make(map[string]int)
+	for _, c := range cryptoWords {
+		counts[c.Algorithm+" "+strings.SplitN(c.Name, "[", 2)[0]]++
+	}
+	for name, want := range map[string]int{"SHA-256 K": 64, "MD5 T": 64, "SHA-256 H": 8} {
+		if counts[name] != want {
+			t.Errorf("%s: %d words registered, want %d", name, counts[name], want)
+		}
+	}
+	// 最后一轮的常量
+	for v, name := range map[uint32]string{0xc67178f2: "K[63]", 0xeb86d391: "T[63]"} {
+		if c, ok := cryptoWords[v]; !ok || c.Name != name {
+			t.Errorf("0x%08x: got %+v, want %s", v, c, name)
+		}
+	}
+}
+
+func TestScanMemory(t *testing.T) {
+	type hit struct {
+		name string
+		at   uint64
+	}
+	scan := func(base uint64, data []byte) []hit {
+		var hits []hit
+		scanMemory(base, data, make(map[uint64]bool), func(c cryptoConstant, at uint64) {
+			hits = append(hits, hit{c.Algorithm + " " + c.Name, at})
+		})
+		return hits
+	}
+
+	// 不对齐的 "expand 32-byte k" 与跨越 16 字节边界的 S-box 开头
+	data := make([]byte, 64)
+	copy(data[3:], "expand 32-byte k")
+	sbox := []byte{0x63, 0x7c, 0x77, 0x7b, 0xf2, 0x6b, 0x6f, 0xc5, 0x30, 0x01, 0x67, 0x2b}
+	copy(data[42:], sbox)
+	binary.LittleEndian.PutUint32(data[56:], 0x9e3779b9)
+
+	want := []hit{
+		{"TEA/XTEA delta", 0x1038},
+		{"AES S-box", 0x102a},
+		{`ChaCha/Salsa20 "expand 32-byte k"`, 0x1003},
+	}
+	got := scan(0x1000, data)
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("hit %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestScanCrypto(t *testing.T) {
+	// movz/movk 拼出 SHA-256 K[0]，中间夹着一行解析失败的日志
+	tm := NewTraceManager()
+	lines := []*TraceLine{
+		{Addr: 0x1000, Instr: "movz w8, #0x2f98"},
+		{Addr: 0x1004, Instr: "movk w8, #0x428a, lsl #16"},
+		nil,
+		{Addr: 0x100c, Instr: "add w9, w9, w8"},
+		{Addr: 0x1010, Instr: "eor w0, w0, #0x9e3779b9"},
+		{Addr: 0x1014, Instr: "nop"},
+	}
+	for i, l := range lines {
+		if l != nil {
+			l.Step = uint32(i)
+			l.Offset = l.Addr
+			l.SP = 0x7fff0000
+			switch {
+			case i >= 3:
+				l.Regs[8] = 0x428a2f98
+			case i >= 1:
+				l.Regs[8] = 0x2f98
+			}
+		}
+		tm.AddInstruction(l)
+	}
+
+	report, err := ScanCrypto(tm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type hit struct {
+		name, source string
+		index        int
+		addr         uint64
+	}
+	want := []hit{
+		// 寄存器新值归到写入它的 movk，而不是解析失败的那一行
+		{"SHA-256 K[0]", "reg x8", 1, 0x1004},
+		{"TEA/XTEA delta", "imm", 4, 0x1010},
+	}
+	if len(report.Hits) != len(want) {
+		t.Fatalf("got %d hits, want %d: %+v", len(report.Hits), len(want), report.Hits)
+	}
+	for i, w := range want {
+		h := report.Hits[i]
+		got := hit{h.Algorithm + " " + h.Name, h.Source, h.FirstIndex, h.Addr}
+		if got != w {
+			t.Errorf("hit %d: got %+v, want %+v", i, got, w)
+		}
+		if h.Function != "sub_1000" {
+			t.Errorf("hit %d: function %q, want sub_1000", i, h.Function)
+		}
+	}
+	if lines := report.Lines(); len(lines) != 2 || lines[0] != 1 || lines[1] != 4 {
+		t.Errorf("Lines() = %v, want [1 4]", lines)
+	}
+}
@@ -0,0 +1,42 @@
+package core
+
+// flow 描述一条指令中的一次数据流动：目的寄存器或内存的新值来自 srcRegs 和 srcMem
+type flow struct {
+	dstReg   int        // 目的寄存器，-1 表示写内存 dstMem
+	dstMem   ValueRange // 写入的内存
+	srcRegs  uint64     // 参与计算的寄存器
+	srcMem   *ValueRange
+	addrRegs uint64 // 访存地址用到的寄存器（不算数据来源，切片时可选择跟随）
+}
+
+// dataflow 结合这一行的寄存器快照，把解码得到的数据流动落实到具体的内存地址
+// reads 是只被读取、不流向任何目的的寄存器（分支条件、跳转地址等）
+// 访存地址优先取 RW 日志，没有日志时按寄存器计算
+func dataflow(t *TraceLine, lm *LogManager) (flows []flow, reads uint64) {
+	d := t.Decode()
+
+	var addr uint64
+	if d.Mem != nil {
+		addr = d.Mem.Address(t)
+		if logs := lm.RwLogs[int(t.Step)]; len(logs) > 0 {
+			addr = logs[0].EffectiveAddress()
+		}
+	}
+
+	for _, f := range d.flows {
+		out := flow{dstReg: f.dst, srcRegs: f.src, addrRegs: f.addr}
+		if f.load || f.dst < 0 {
+			width := uint64(d.Mem.Size / f.slots)
+			r := ValueRange{Low: addr + uint64(f.slot)*width, High: addr + uint64(f.slot+1)*width - 1}
+			// 原子指令写回的值由内存旧值算出，两者都有
+			if f.load {
+				out.srcMem = &r
+			}
+			if f.dst < 0 {
+				out.dstMem = r
+			}
+		}
+		flows = append(flows, out)
+	}
+	return flows, d.reads
+}
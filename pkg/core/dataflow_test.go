@@ -0,0 +1,159 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// formatFlows 展开 srcMem 指针，方便比较失败时阅读
+func formatFlows(flows []flow) string {
+	var parts []string
+	for _, f := range flows {
+		s := fmt.Sprintf("{dst %d", f.dstReg)
+		if f.dstReg < 0 {
+			s += fmt.Sprintf(" mem %#x-%#x", f.dstMem.Low, f.dstMem.High)
+		}
+		s += fmt.Sprintf(" src [%s]", formatRegMask(f.srcRegs))
+		if f.srcMem != nil {
+			s += fmt.Sprintf(" mem %#x-%#x", f.srcMem.Low, f.srcMem.High)
+		}
+		parts = append(parts, s+fmt.Sprintf(" addr [%s]}", formatRegMask(f.addrRegs)))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestDataflow(t *testing.T) {
+	mem := func(lo, hi uint64) *ValueRange { return &ValueRange{Low: lo, High: hi} }
+
+	tests := []struct {
+		name  string
+		line  TraceLine
+		rw    *RWLogEntry // 这一步的 RW 日志，nil 表示没有
+		flows []flow
+		reads uint64
+	}{
+		{
+			name: "load",
+			line: TraceLine{Instr: "ldr x3, [x1, #0x10]", Regs: [31]uint64{1: 0x1000}},
+			flows: []flow{
+				{dstReg: 3, srcMem: mem(0x1010, 0x1017), addrRegs: regs(1)},
+			},
+		},
+		{
+			name: "load address from RW log",
+			line: TraceLine{Step: 5, Instr: "ldr w0, [x1]", Regs: [31]uint64{1: 0x1000}},
+			rw:   &RWLogEntry{LogEntry: LogEntry{Step: 5}, Type: "r", Address: "0x2000", Offset: "0x4"},
+			flows: []flow{
+				{dstReg: 0, srcMem: mem(0x2004, 0x2007), addrRegs: regs(1)},
+			},
+		},
+		{
+			name: "store pair with pre-index",
+			line: TraceLine{Instr: "stp x0, x1, [sp, #-0x10]!", SP: 0x8000},
+			flows: []flow{
+				{dstReg: -1, dstMem: ValueRange{Low: 0x7ff0, High: 0x7ff7}, srcRegs: regs(0), addrRegs: regs(31)},
+				{dstReg: -1, dstMem: ValueRange{Low: 0x7ff8, High: 0x7fff}, srcRegs: regs(1), addrRegs: regs(31)},
+				{dstReg: 31, srcRegs: regs(31)},
+			},
+		},
+		{
+			name: "load pair with post-index",
+			line: TraceLine{Instr: "ldp x29, x30, [sp], #0x10", SP: 0x7ff0},
+			flows: []flow{
+				{dstReg: 29, srcMem: mem(0x7ff0, 0x7ff7), addrRegs: regs(31)},
+				{dstReg: 30, srcMem: mem(0x7ff8, 0x7fff), addrRegs: regs(31)},
+				{dstReg: 31, srcRegs: regs(31)},
+			},
+		},
+		{
+			name: "register index",
+			line: TraceLine{Instr: "ldrb w2, [x0, x1]", Regs: [31]uint64{0: 0x3000, 1: 0x20}},
+			flows: []flow{
+				{dstReg: 2, srcMem: mem(0x3020, 0x3020), addrRegs: regs(0, 1)},
+			},
+		},
+		{
+			name: "exclusive store",
+			line: TraceLine{Instr: "stxr w2, x1, [x0]", Regs: [31]uint64{0: 0x4000}},
+			flows: []flow{
+				{dstReg: 2},
+				{dstReg: -1, dstMem: ValueRange{Low: 0x4000, High: 0x4007}, srcRegs: regs(1), addrRegs: regs(0)},
+			},
+		},
+		{
+			name: "atomic add",
+			line: TraceLine{Instr: "ldadd w0, w1, [x2]", Regs: [31]uint64{2: 0x5000}},
+			flows: []flow{
+				{dstReg: 1, srcMem: mem(0x5000, 0x5003), addrRegs: regs(2)},
+				{dstReg: -1, dstMem: ValueRange{Low: 0x5000, High: 0x5003}, srcRegs: regs(0), srcMem: mem(0x5000, 0x5003), addrRegs: regs(2)},
+			},
+		},
+		{
+			name: "swap",
+			line: TraceLine{Instr: "swp x0, x1, [x2]", Regs: [31]uint64{2: 0x5000}},
+			flows: []flow{
+				{dstReg: 1, srcMem: mem(0x5000, 0x5007), addrRegs: regs(2)},
+				{dstReg: -1, dstMem: ValueRange{Low: 0x5000, High: 0x5007}, srcRegs: regs(0), addrRegs: regs(2)},
+			},
+		},
+		{
+			name:  "arithmetic",
+			line:  TraceLine{Instr: "add x0, x1, x2"},
+			flows: []flow{{dstReg: 0, srcRegs: regs(1, 2)}},
+		},
+		{
+			name:  "partial move",
+			line:  TraceLine{Instr: "movk x0, #0x1234, lsl #16"},
+			flows: []flow{{dstReg: 0, srcRegs: regs(0)}},
+		},
+		{
+			name: "flag setter",
+			line: TraceLine{Instr: "subs x0, x0, #1"},
+			flows: []flow{
+				{dstReg: 0, srcRegs: regs(0)},
+				{dstReg: RegFlags, srcRegs: regs(0)},
+			},
+		},
+		{
+			name:  "compare",
+			line:  TraceLine{Instr: "cmp x0, x1"},
+			flows: []flow{{dstReg: RegFlags, srcRegs: regs(0, 1)}},
+		},
+		{
+			name:  "call",
+			line:  TraceLine{Instr: "bl #0x7fda102000"},
+			flows: []flow{{dstReg: 30}},
+		},
+		{
+			name:  "indirect branch",
+			line:  TraceLine{Instr: "br x16"},
+			reads: regs(16),
+		},
+		{
+			name:  "conditional branch",
+			line:  TraceLine{Instr: "b.ne #0x1000"},
+			reads: regs(RegFlags),
+		},
+		{
+			name:  "untracked load",
+			line:  TraceLine{Instr: "ldr q0, [x0]"},
+			reads: regs(0),
+		},
+	}
+
+	for _, tt := range tests {
+		lm := NewLogManager()
+		if tt.rw != nil {
+			lm.RwLogs[tt.rw.Step] = []*RWLogEntry{tt.rw}
+		}
+		flows, reads := dataflow(&tt.line, lm)
+		if !reflect.DeepEqual(flows, tt.flows) {
+			t.Errorf("%s: flows\n got %s\nwant %s", tt.name, formatFlows(flows), formatFlows(tt.flows))
+		}
+		if reads != tt.reads {
+			t.Errorf("%s: reads %s, want %s", tt.name, formatRegMask(reads), formatRegMask(tt.reads))
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+)
+
+// RegFlags 是 NZCV 条件标志在寄存器掩码中的位（0-30 为 x0-x30，31 为 SP）
+const RegFlags = 33
+
+// Operand 是指令的一个操作数
+type Operand struct {
+	Text  string
+	Reg   int   // 通用寄存器编号（x/w0-30 为 0-30，sp/wsp 为 31），其他为 -1
+	Imm   int64 // 立即数的值，IsImm 为 false 时无效
+	IsImm bool
+}
+
+// MemOperand 是访存指令的内存操作数
+type MemOperand struct {
+	Base      int   // 基址寄存器
+	Index     int   // 变址寄存器，-1 表示没有
+	IndexW    bool  // 变址寄存器是 w 寄存器
+	Shift     uint  // 变址寄存器左移的位数
+	Offset    int64 // 立即数偏移，后变址时为写回基址的增量
+	PreIndex  bool  // [xn, #imm]!
+	PostIndex bool  // [xn], #imm
+	Size      int   // 一次访问的总字节数
+}
+
+// Address 按 t 中的寄存器计算访问的地址
+func (m *MemOperand) Address(t *TraceLine) uint64 {
+	addr := t.RegisterValue(m.Base)
+	if !m.PostIndex {
+		addr += uint64(m.Offset)
+	}
+	if m.Index >= 0 {
+		offset := t.RegisterValue(m.Index)
+		if m.IndexW {
+			offset &= 0xffffffff
+		}
+		addr += offset << m.Shift
+	}
+	return addr
+}
+
+// DecodedInstr 是解析后的指令
+// 寄存器掩码中位 0-30 为 x0-x30，31 为 SP，RegFlags 为条件标志；SIMD/浮点寄存器不跟踪
+type DecodedInstr struct {
+	Mnemonic string // 小写，如 "ldr"、"b.ne"
+	Operands []Operand
+	Reads    uint64 // 读取的寄存器（含访存地址用到的寄存器）
+	Writes   uint64 // 写入的寄存器
+	Mem      *MemOperand
+	Load     bool
+	Store    bool
+
+	Branch       bool // 改变控制流的指令（含调用和返回）
+	Call         bool
+	Return       bool
+	BranchTarget uint64 // 直接跳转的目标，HasTarget 为 false 时无效
+	HasTarget    bool
+
+	flows []regFlow
+	reads uint64 // 只被读取、不流向任何目的的寄存器（分支条件、跳转地址等）
+}
+
+// regFlow 是与寄存器取值无关的一次数据流动，内存地址由 dataflow 结合快照计算
+// 内存操作数按数据寄存器个数均分为 slots 个槽（ldp/stp 的两个寄存器各占一半）
+type regFlow struct {
+	dst   int    // 目的寄存器，-1 表示写内存的第 slot 个槽
+	src   uint64 // 参与计算的寄存器
+	load  bool   // 值来自内存的第 slot 个槽（原子指令写内存时为旧值）
+	slot  int
+	slots int
+	addr  uint64 // 访存地址用到的寄存器
+}
+
+// Decode 解析反汇编文本，如 "ldr x3, [x1, #0x10]"、"bl #0x7fda102000"
+// 总是只依赖指令文本，不解码机器码
+func Decode(instr string) *DecodedInstr {
+	m, texts := splitOperands(instr)
+	d := &DecodedInstr{Mnemonic: m}
+	memIdx := -1
+	for i, text := range texts {
+		op := Operand{Text: text, Reg: RegisterIndex(text)}
+		if op.Reg == 32 {
+			op.Reg = -1
+		}
+		if strings.HasPrefix(text, "#") {
+			if v, err := strconv.ParseInt(text[1:], 0, 64); err == nil {
+				op.Imm, op.IsImm = v, true
+			}
+		}
+		if strings.HasPrefix(text, "[") && memIdx == -1 {
+			memIdx = i
+		}
+		d.Operands = append(d.Operands, op)
+	}
+
+	switch {
+	case memIdx != -1 && atomicKind(m) != "":
+		d.decodeAtomic(atomicKind(m), memIdx, instr)
+	case memIdx != -1 && (strings.HasPrefix(m, "ld") || strings.HasPrefix(m, "st")):
+		d.decodeMemory(memIdx, instr)
+	case isBranchMnemonic(m):
+		d.decodeBranch()
+	default:
+		d.decodeData()
+	}
+
+	for _, f := range d.flows {
+		if f.dst >= 0 {
+			d.Writes |= 1 << uint(f.dst)
+		}
+		d.Reads |= f.src | f.addr
+	}
+	d.Reads |= d.reads
+	return d
+}
+
+// Decode 返回（必要时解析）这一行指令的解码结果
+func (t *TraceLine) Decode() *DecodedInstr {
+	if t.decoded == nil {
+		t.decoded = Decode(t.Instr)
+	}
+	return t.decoded
+}
+
+func regBit(reg int) uint64 {
+	if reg < 0 {
+		return 0
+	}
+	return 1 << uint(reg)
+}
+
+// decodeMemory 解析 ldr/str/ldp/stp/ldxr/stxr 等访存指令
+func (d *DecodedInstr) decodeMemory(memIdx int, instr string) {
+	m := d.Mnemonic
+	mem := parseMemOperand(d.Operands[memIdx].Text)
+	if memIdx+1 < len(d.Operands) && d.Operands[memIdx+1].IsImm {
+		mem.PostIndex = true
+		mem.Offset = d.Operands[memIdx+1].Imm
+	}
+	mem.Size = accessSize(instr)
+	d.Mem = mem
+
+	var addrRegs uint64
+	addrRegs |= regBit(mem.Base) | regBit(mem.Index)
+
+	data := d.Operands[:memIdx]
+	d.Store = strings.HasPrefix(m, "st")
+	d.Load = !d.Store
+	if d.Store && len(data) > 1 && strings.Contains(m[2:], "x") {
+		// stxr/stlxr 的第一个操作数是状态寄存器
+		if data[0].Reg >= 0 {
+			d.flows = append(d.flows, regFlow{dst: data[0].Reg})
+		}
+		data = data[1:]
+		// stxrb/stxrh 的大小由后缀决定，数据寄存器总是 w
+		if !strings.HasSuffix(m, "b") && !strings.HasSuffix(m, "h") {
+			if strings.HasPrefix(data[0].Text, "w") {
+				mem.Size = 4 * len(data)
+			} else {
+				mem.Size = 8 * len(data)
+			}
+		}
+	}
+	for i, op := range data {
+		if d.Store {
+			d.flows = append(d.flows, regFlow{dst: -1, src: regBit(op.Reg), slot: i, slots: len(data), addr: addrRegs})
+		} else if op.Reg >= 0 {
+			d.flows = append(d.flows, regFlow{dst: op.Reg, load: true, slot: i, slots: len(data), addr: addrRegs})
+		}
+	}
+
+	// 前变址/后变址会更新基址寄存器
+	if mem.PreIndex || mem.PostIndex {
+		d.flows = append(d.flows, regFlow{dst: mem.Base, src: regBit(mem.Base)})
+	}
+	// 数据寄存器都不跟踪（如 ldr q0）时，地址寄存器仍然被读取
+	if len(d.flows) == 0 {
+		d.reads = addrRegs
+	}
+}
+
+// atomicOps 是 LSE 原子读改写指令 ld<op>/st<op> 中的运算名
+var atomicOps = []string{"add", "clr", "eor", "set", "smax", "smin", "umax", "umin"}
+
+// atomicKind 识别 LSE 原子指令，返回 "ld"（ldadd 等）、"st"（stadd 等）、"swp"、"cas" 或 "casp"，
+// 不是原子指令时返回空串；a/l 内存序后缀和 b/h 大小后缀不影响数据流
+func atomicKind(m string) string {
+	var kind, rest string
+	switch {
+	case strings.HasPrefix(m, "casp"):
+		kind, rest = "casp", m[4:]
+	case strings.HasPrefix(m, "cas"):
+		kind, rest = "cas", m[3:]
+	case strings.HasPrefix(m, "swp"):
+		kind, rest = "swp", m[3:]
+	case strings.HasPrefix(m, "ld"), strings.HasPrefix(m, "st"):
+		for _, op := range atomicOps {
+			if strings.HasPrefix(m[2:], op) {
+				kind, rest = m[:2], m[2+len(op):]
+				break
+			}
+		}
+		if kind == "" {
+			return ""
+		}
+	default:
+		return ""
+	}
+	rest = strings.TrimPrefix(rest, "a")
+	rest = strings.TrimPrefix(rest, "l")
+	if rest != "" && rest != "b" && rest != "h" {
+		return ""
+	}
+	return kind
+}
+
+// decodeAtomic 解析 LSE 原子指令：ld<op> Rs, Rt 和 swp Rs, Rt 把内存旧值读入 Rt，
+// cas Rs, Rt 把旧值读入 Rs；写回内存的新值除 swp 外都还取决于旧值
+func (d *DecodedInstr) decodeAtomic(kind string, memIdx int, instr string) {
+	mem := parseMemOperand(d.Operands[memIdx].Text)
+	mem.Size = accessSize(instr)
+	d.Mem = mem
+	d.Load = kind != "st"
+	d.Store = true
+
+	addrRegs := regBit(mem.Base)
+	data := d.Operands[:memIdx]
+	load := func(reg, slot, slots int) {
+		if reg >= 0 {
+			d.flows = append(d.flows, regFlow{dst: reg, load: true, slot: slot, slots: slots, addr: addrRegs})
+		}
+	}
+	store := func(src uint64, old bool, slot, slots int) {
+		d.flows = append(d.flows, regFlow{dst: -1, src: src, load: old, slot: slot, slots: slots, addr: addrRegs})
+	}
+
+	switch {
+	case kind == "st" && len(data) >= 1:
+		store(regBit(data[0].Reg), true, 0, 1)
+	case (kind == "ld" || kind == "swp") && len(data) >= 2:
+		load(data[1].Reg, 0, 1)
+		store(regBit(data[0].Reg), kind == "ld", 0, 1)
+	case kind == "cas" && len(data) >= 2:
+		load(data[0].Reg, 0, 1)
+		store(regBit(data[0].Reg)|regBit(data[1].Reg), true, 0, 1)
+	case kind == "casp" && len(data) >= 4:
+		for i := 0; i < 2; i++ {
+			load(data[i].Reg, i, 2)
+			store(regBit(data[i].Reg)|regBit(data[i+2].Reg), true, i, 2)
+		}
+	}
+	if len(d.flows) == 0 {
+		d.reads = addrRegs
+	}
+}
+
+// parseMemOperand 解析 "[x1, #0x10]"、"[sp, #-16]!"、"[x0, x2, lsl #3]"
+func parseMemOperand(text string) *MemOperand {
+	mem := &MemOperand{Index: -1, PreIndex: strings.HasSuffix(text, "!")}
+	inner := strings.TrimSuffix(strings.TrimSpace(text), "!")
+	inner = strings.TrimSuffix(strings.TrimPrefix(inner, "["), "]")
+	parts := strings.Split(inner, ",")
+
+	mem.Base = RegisterIndex(parts[0])
+	for _, p := range parts[1:] {
+		p = strings.TrimSpace(p)
+		switch {
+		case strings.HasPrefix(p, "#"):
+			if v, err := strconv.ParseInt(p[1:], 0, 64); err == nil {
+				mem.Offset = v
+			}
+		case RegisterIndex(p) >= 0:
+			mem.Index = RegisterIndex(p)
+			mem.IndexW = p[0] == 'w'
+		default:
+			// lsl #3、sxtw #2 等
+			if i := strings.Index(p, "#"); i != -1 {
+				if v, err := strconv.Atoi(p[i+1:]); err == nil {
+					mem.Shift = uint(v)
+				}
+			}
+		}
+	}
+	return mem
+}
+
+func isBranchMnemonic(m string) bool {
+	switch m {
+	case "b", "br", "bl", "blr", "cbz", "cbnz", "tbz", "tbnz",
+		"ret", "retaa", "retab", "braa", "brab", "braaz", "brabz", "blraa", "blrab", "blraaz", "blrabz":
+		return true
+	}
+	return strings.HasPrefix(m, "b.")
+}
+
+// decodeBranch 解析分支、调用和返回
+func (d *DecodedInstr) decodeBranch() {
+	m := d.Mnemonic
+	d.Branch = true
+	d.Call = m == "bl" || strings.HasPrefix(m, "blr")
+	d.Return = strings.HasPrefix(m, "ret")
+
+	for _, op := range d.Operands {
+		d.reads |= regBit(op.Reg)
+	}
+	if strings.HasPrefix(m, "b.") {
+		d.reads |= regBit(RegFlags)
+	}
+	if d.Return && len(d.Operands) == 0 {
+		d.reads |= regBit(30)
+	}
+
+	// 直接跳转的目标是最后一个操作数
+	switch {
+	case m == "b", m == "bl", m == "cbz", m == "cbnz", m == "tbz", m == "tbnz", strings.HasPrefix(m, "b."):
+		if n := len(d.Operands); n > 0 {
+			last := strings.TrimPrefix(d.Operands[n-1].Text, "#")
+			if v, err := strconv.ParseUint(last, 0, 64); err == nil {
+				d.BranchTarget, d.HasTarget = v, true
+			}
+		}
+	}
+
+	if d.Call {
+		d.flows = append(d.flows, regFlow{dst: 30})
+	}
+}
+
+// decodeData 解析数据处理和传送指令：第一个操作数为目的寄存器
+// （cmp/tst 之类没有目的寄存器），其余寄存器为源
+func (d *DecodedInstr) decodeData() {
+	m := d.Mnemonic
+	dest := -1
+	sources := d.Operands
+	switch m {
+	case "cmp", "cmn", "tst", "ccmp", "ccmn", "fcmp", "fcmpe", "msr", "prfm", "dmb", "dsb", "isb", "nop", "hint", "svc":
+	default:
+		if len(d.Operands) > 0 {
+			dest, sources = d.Operands[0].Reg, d.Operands[1:]
+		}
+	}
+
+	var src uint64
+	for _, op := range sources {
+		src |= regBit(op.Reg)
+	}
+	switch m {
+	case "movk", "bfi", "bfxil", "bfm", "bfc":
+		// 只修改目的寄存器的一部分
+		src |= regBit(dest)
+	case "adr", "adrp", "movz", "movn":
+		src = 0
+	}
+	if isFlagReader(m) {
+		src |= regBit(RegFlags)
+	}
+
+	if dest >= 0 {
+		d.flows = append(d.flows, regFlow{dst: dest, src: src})
+	}
+	if isFlagSetter(m) {
+		d.flows = append(d.flows, regFlow{dst: RegFlags, src: src})
+	}
+	if len(d.flows) == 0 {
+		d.reads = src
+	}
+}
+
+// splitOperands 按逗号拆分指令的操作数，方括号内的逗号不拆
+func splitOperands(instr string) (string, []string) {
+	instr = strings.ToLower(strings.TrimSpace(instr))
+	sp := strings.IndexAny(instr, " \t")
+	if sp == -1 {
+		return instr, nil
+	}
+	mnemonic, rest := instr[:sp], instr[sp+1:]
+
+	var ops []string
+	depth, begin := 0, 0
+	for i := 0; i < len(rest); i++ {
+		switch rest[i] {
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				ops = append(ops, strings.TrimSpace(rest[begin:i]))
+				begin = i + 1
+			}
+		}
+	}
+	if last := strings.TrimSpace(rest[begin:]); last != "" {
+		ops = append(ops, last)
+	}
+	return mnemonic, ops
+}
+
+// isFlagReader 报告指令是否读取条件标志
+func isFlagReader(m string) bool {
+	switch m {
+	case "csel", "csinc", "csinv", "csneg", "cset", "csetm", "cinc", "cinv", "cneg",
+		"adc", "adcs", "sbc", "sbcs", "ngc", "ngcs", "ccmp", "ccmn", "fcsel":
+		return true
+	}
+	return false
+}
+
+// isFlagSetter 报告指令是否写条件标志
+func isFlagSetter(m string) bool {
+	switch m {
+	case "cmp", "cmn", "tst", "ccmp", "ccmn", "fcmp", "fcmpe":
+		return true
+	}
+	return len(m) > 1 && strings.HasSuffix(m, "s") && m != "cls" &&
+		(strings.HasPrefix(m, "add") || strings.HasPrefix(m, "sub") || strings.HasPrefix(m, "and") ||
+			strings.HasPrefix(m, "bic") || strings.HasPrefix(m, "neg") || strings.HasPrefix(m, "adc") ||
+			strings.HasPrefix(m, "sbc") || strings.HasPrefix(m, "ngc"))
+}
+
+// accessSize 根据访存指令推断一次访问的字节数，无法判断时按 8 字节处理
+func accessSize(instr string) int {
+	fields := strings.Fields(strings.ToLower(instr))
+	if len(fields) < 2 {
+		return 8
+	}
+	m := fields[0]
+
+	size := 8
+	switch {
+	case strings.HasSuffix(m, "b"):
+		size = 1
+	case strings.HasSuffix(m, "h"):
+		size = 2
+	case m == "ldrsw" || m == "ldursw" || m == "ldpsw":
+		size = 4
+	default:
+		// 由第一个寄存器操作数的宽度决定，格式不对（如 "ldr , [x0]"）时按默认处理
+		if op := strings.TrimSuffix(fields[1], ","); op != "" {
+			switch op[0] {
+			case 'w', 's':
+				size = 4
+			case 'q':
+				size = 16
+			}
+		}
+	}
+
+	// ldp/stp、ldxp/stxp 和 casp 一次访问两个寄存器
+	if strings.HasPrefix(m, "ldp") || strings.HasPrefix(m, "stp") ||
+		strings.HasPrefix(m, "ldnp") || strings.HasPrefix(m, "stnp") ||
+		strings.HasSuffix(m, "xp") || strings.HasPrefix(m, "casp") {
+		size *= 2
+	}
+	return size
+}
@@ -0,0 +1,132 @@
+package core
+
+import "testing"
+
+func regs(rs ...int) uint64 {
+	var mask uint64
+	for _, r := range rs {
+		mask |= 1 << uint(r)
+	}
+	return mask
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		instr  string
+		reads  uint64
+		writes uint64
+		mem    *MemOperand // nil 表示不是访存指令
+		load   bool
+		store  bool
+	}{
+		{"ldr x3, [x1, #0x10]", regs(1), regs(3), &MemOperand{Base: 1, Index: -1, Offset: 0x10, Size: 8}, true, false},
+		{"ldr w0, [x1, x2, lsl #2]", regs(1, 2), regs(0), &MemOperand{Base: 1, Index: 2, Shift: 2, Size: 4}, true, false},
+		{"ldr x0, [x1, w2, sxtw #3]", regs(1, 2), regs(0), &MemOperand{Base: 1, Index: 2, IndexW: true, Shift: 3, Size: 8}, true, false},
+		{"ldrb w1, [x0]", regs(0), regs(1), &MemOperand{Base: 0, Index: -1, Size: 1}, true, false},
+		{"ldrsw x1, [x0, #4]", regs(0), regs(1), &MemOperand{Base: 0, Index: -1, Offset: 4, Size: 4}, true, false},
+		{"ldr q0, [x0]", regs(0), 0, &MemOperand{Base: 0, Index: -1, Size: 16}, true, false},
+		{"str x0, [sp, #8]", regs(0, 31), 0, &MemOperand{Base: 31, Index: -1, Offset: 8, Size: 8}, false, true},
+		{"strh w2, [x3], #2", regs(2, 3), regs(3), &MemOperand{Base: 3, Index: -1, Offset: 2, PostIndex: true, Size: 2}, false, true},
+		{"stp x29, x30, [sp, #-0x10]!", regs(29, 30, 31), regs(31), &MemOperand{Base: 31, Index: -1, Offset: -0x10, PreIndex: true, Size: 16}, false, true},
+		{"ldp x29, x30, [sp], #0x10", regs(31), regs(29, 30, 31), &MemOperand{Base: 31, Index: -1, Offset: 0x10, PostIndex: true, Size: 16}, true, false},
+		{"ldp w1, w2, [x0]", regs(0), regs(1, 2), &MemOperand{Base: 0, Index: -1, Size: 8}, true, false},
+		{"stxr w2, x1, [x0]", regs(0, 1), regs(2), &MemOperand{Base: 0, Index: -1, Size: 8}, false, true},
+		{"stlxr w2, w1, [x0]", regs(0, 1), regs(2), &MemOperand{Base: 0, Index: -1, Size: 4}, false, true},
+		{"stxrb w2, w1, [x0]", regs(0, 1), regs(2), &MemOperand{Base: 0, Index: -1, Size: 1}, false, true},
+		{"stlxrh w2, w1, [x0]", regs(0, 1), regs(2), &MemOperand{Base: 0, Index: -1, Size: 2}, false, true},
+		{"stxp w4, x1, x2, [x0]", regs(0, 1, 2), regs(4), &MemOperand{Base: 0, Index: -1, Size: 16}, false, true},
+		{"ldxp x0, x1, [x2]", regs(2), regs(0, 1), &MemOperand{Base: 2, Index: -1, Size: 16}, true, false},
+		{"ldaxp w0, w1, [x2]", regs(2), regs(0, 1), &MemOperand{Base: 2, Index: -1, Size: 8}, true, false},
+		{"ldpsw x0, x1, [x2]", regs(2), regs(0, 1), &MemOperand{Base: 2, Index: -1, Size: 8}, true, false},
+		{"ldaddal w0, w1, [x2]", regs(0, 2), regs(1), &MemOperand{Base: 2, Index: -1, Size: 4}, true, true},
+		{"ldsetlb w0, w1, [x2]", regs(0, 2), regs(1), &MemOperand{Base: 2, Index: -1, Size: 1}, true, true},
+		{"stadd x0, [x1]", regs(0, 1), 0, &MemOperand{Base: 1, Index: -1, Size: 8}, false, true},
+		{"swpah w0, w1, [x2]", regs(0, 2), regs(1), &MemOperand{Base: 2, Index: -1, Size: 2}, true, true},
+		{"casal x0, x1, [x2]", regs(0, 1, 2), regs(0), &MemOperand{Base: 2, Index: -1, Size: 8}, true, true},
+		{"caspal x0, x1, x2, x3, [x4]", regs(0, 1, 2, 3, 4), regs(0, 1), &MemOperand{Base: 4, Index: -1, Size: 16}, true, true},
+		{"mov x2, x0", regs(0), regs(2), nil, false, false},
+		{"mov x0, #0x20", 0, regs(0), nil, false, false},
+		{"movk x0, #0x1234, lsl #16", regs(0), regs(0), nil, false, false},
+		{"adrp x1, #0x7fda105000", 0, regs(1), nil, false, false},
+		{"add x0, x1, x2", regs(1, 2), regs(0), nil, false, false},
+		{"adds x0, x1, #1", regs(1), regs(0, RegFlags), nil, false, false},
+		{"cmp x0, #1", regs(0), regs(RegFlags), nil, false, false},
+		{"csel x0, x1, x2, eq", regs(1, 2, RegFlags), regs(0), nil, false, false},
+		{"eor w8, w0, #0x9e3779b9", regs(0), regs(8), nil, false, false},
+		{"mov sp, x29", regs(29), regs(31), nil, false, false},
+	}
+
+	for _, tt := range tests {
+		d := Decode(tt.instr)
+		if d.Reads != tt.reads || d.Writes != tt.writes {
+			t.Errorf("%q: reads %s / writes %s, want %s / %s", tt.instr,
+				formatRegMask(d.Reads), formatRegMask(d.Writes), formatRegMask(tt.reads), formatRegMask(tt.writes))
+		}
+		if d.Load != tt.load || d.Store != tt.store {
+			t.Errorf("%q: load %v store %v, want %v %v", tt.instr, d.Load, d.Store, tt.load, tt.store)
+		}
+		switch {
+		case tt.mem == nil && d.Mem != nil:
+			t.Errorf("%q: unexpected memory operand %+v", tt.instr, *d.Mem)
+		case tt.mem != nil && d.Mem == nil:
+			t.Errorf("%q: missing memory operand", tt.instr)
+		case tt.mem != nil && *d.Mem != *tt.mem:
+			t.Errorf("%q: memory operand %+v, want %+v", tt.instr, *d.Mem, *tt.mem)
+		}
+		if d.Branch {
+			t.Errorf("%q: decoded as a branch", tt.instr)
+		}
+	}
+}
+
+func TestDecodeBranch(t *testing.T) {
+	tests := []struct {
+		instr     string
+		call, ret bool
+		target    uint64
+		hasTarget bool
+		reads     uint64
+		writes    uint64
+	}{
+		{"bl #0x7fda102000", true, false, 0x7fda102000, true, 0, regs(30)},
+		{"blr x8", true, false, 0, false, regs(8), regs(30)},
+		{"b #0x1000", false, false, 0x1000, true, 0, 0},
+		{"b.ne #0x1000", false, false, 0x1000, true, regs(RegFlags), 0},
+		{"cbz w0, #0x2000", false, false, 0x2000, true, regs(0), 0},
+		{"tbnz x1, #3, #0x2000", false, false, 0x2000, true, regs(1), 0},
+		{"br x16", false, false, 0, false, regs(16), 0},
+		{"ret", false, true, 0, false, regs(30), 0},
+		{"ret x1", false, true, 0, false, regs(1), 0},
+	}
+
+	for _, tt := range tests {
+		d := Decode(tt.instr)
+		if !d.Branch || d.Call != tt.call || d.Return != tt.ret {
+			t.Errorf("%q: branch %v call %v return %v, want true %v %v", tt.instr, d.Branch, d.Call, d.Return, tt.call, tt.ret)
+		}
+		if d.HasTarget != tt.hasTarget || d.BranchTarget != tt.target {
+			t.Errorf("%q: target %#x (%v), want %#x (%v)", tt.instr, d.BranchTarget, d.HasTarget, tt.target, tt.hasTarget)
+		}
+		if d.Reads != tt.reads || d.Writes != tt.writes {
+			t.Errorf("%q: reads %s / writes %s, want %s / %s", tt.instr,
+				formatRegMask(d.Reads), formatRegMask(d.Writes), formatRegMask(tt.reads), formatRegMask(tt.writes))
+		}
+	}
+}
+
+// 格式不对的指令文本不能让解码或数据流分析崩溃
+func TestDecodeMalformed(t *testing.T) {
+	for _, instr := range []string{
+		"", "   ", "ldr", "ldr ,", "ldr , [x0]", "ldp , , [x0]", "str x0, []", "ldr x0, [",
+		"stxr , x1, [x0]", "stxr w0, , [x0]", "stxr wzr, x1, [x0]", "ldadd w0, wzr, [x1]", "cas , , [x0]", "casp x0, [x1]", "stadd [x0]", "str xzr, [x0]", ",,,", "b.", "bl", "ret ,", "[x0]",
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%q: panic: %v", instr, r)
+				}
+			}()
+			dataflow(&TraceLine{Instr: instr}, NewLogManager())
+		}()
+	}
+}
@@ -0,0 +1,79 @@
+package core
+
+// LastWrite 返回第 index 行之前最后一次改变寄存器 reg 的指令：
+// 比较相邻两行的快照，值发生变化的前一行就是写入者；值没变的写入无法识别
+// value 为写入后的值，没有找到时 found 为 -1
+func (tm *TraceManager) LastWrite(index, reg int) (writer *TraceLine, found int, value uint64, err error) {
+	var prev *TraceLine
+	prevIndex := -1
+	found = -1
+	err = tm.Scan(func(i int, t *TraceLine) bool {
+		if i > index {
+			return false
+		}
+		// 解析失败的行会被跳过，上一行不一定是 i-1
+		if prev != nil && prev.RegisterValue(reg) != t.RegisterValue(reg) {
+			writer, found, value = prev, prevIndex, t.RegisterValue(reg)
+		}
+		prev, prevIndex = t, i
+		return true
+	})
+	return writer, found, value, err
+}
+
+// SourceRegister 按操作数顺序返回指令 t 中流向 reg 的第一个源寄存器，
+// 值来自内存或立即数时返回 -1 以及是否来自内存
+func SourceRegister(t *TraceLine, reg int, lm *LogManager) (int, bool) {
+	flows, _ := dataflow(t, lm)
+	var srcs uint64
+	fromMemory := false
+	for _, f := range flows {
+		if f.dstReg == reg {
+			srcs |= f.srcRegs
+			fromMemory = fromMemory || f.srcMem != nil
+		}
+	}
+
+	ops := t.Decode().Operands
+	for i, op := range ops {
+		r := op.Reg
+		if i == 0 && r == reg && len(ops) > 1 {
+			// 目的寄存器；movk 之类同时读取它，放到最后考虑
+			continue
+		}
+		if r >= 0 && r < 32 && srcs&(1<<uint(r)) != 0 {
+			return r, false
+		}
+	}
+	if srcs&(1<<uint(reg)) != 0 {
+		return reg, false
+	}
+	return -1, fromMemory
+}
+
+// NextUses 列出从第 index 行开始读取寄存器 reg 的指令，直到 reg 被重新写入为止，最多 limit 条
+// overwritten 为覆盖它的行，一直没有被覆盖时为 -1
+func (tm *TraceManager) NextUses(index, reg, limit int) (uses []LineRef, overwritten int, err error) {
+	overwritten = -1
+	bit := uint64(1) << uint(reg)
+	err = tm.Scan(func(i int, t *TraceLine) bool {
+		if i < index {
+			return true
+		}
+		flows, reads := dataflow(t, tm.LogManager)
+		written := false
+		for _, f := range flows {
+			reads |= f.srcRegs | f.addrRegs
+			written = written || f.dstReg == reg
+		}
+		if reads&bit != 0 {
+			uses = append(uses, NewLineRef(i, t))
+		}
+		if written {
+			overwritten = i
+			return false
+		}
+		return len(uses) < limit
+	})
+	return uses, overwritten, err
+}
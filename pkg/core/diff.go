@@ -0,0 +1,400 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	diffResyncWindow   = 4096 // 分叉后向前寻找重新对齐点的行数
+	diffResyncMatch    = 4    // 重新对齐要求连续相同的指令数
+	maxDiffDivergences = 1000 // 超过后剩余部分不再对齐
+)
+
+// DiffSegment 是对齐结果中的一段：Aligned 为 true 时两边逐行对应（LenA == LenB），
+// 否则是控制流分叉的部分，两边各自执行了 LenA / LenB 行
+type DiffSegment struct {
+	A, B       int
+	LenA, LenB int
+	Aligned    bool
+
+	row int // 这一段第一行在并排视图中的行号
+}
+
+// rows 返回这一段在并排视图中占的行数
+func (s *DiffSegment) rows() int {
+	return max(s.LenA, s.LenB)
+}
+
+// RegDiff 是对齐的两行中第一个取值不同的寄存器
+type RegDiff struct {
+	A, B   int
+	Reg    string
+	ValueA uint64
+	ValueB uint64
+}
+
+// TraceDiff 是两条 trace 按 PC 序列对齐的结果
+// 比较的是模块内偏移（Offset），所以两次执行的模块基址不同（ASLR）也能对齐
+type TraceDiff struct {
+	LenA, LenB   int
+	CodeDelta    uint64 // 模块基址之差（A - B）
+	StackDelta   uint64 // 初始 SP 之差（A - B）
+	Segments     []*DiffSegment
+	FirstRegDiff *RegDiff // 控制流分叉之前第一个寄存器不同的位置，nil 表示没有
+}
+
+// traceOffsets 返回每一行的模块内偏移，解析失败的行用 ^0 占位
+func traceOffsets(tm *TraceManager) ([]uint64, *TraceLine, error) {
+	offsets := make([]uint64, 0, tm.Total())
+	var first *TraceLine
+	err := tm.Scan(func(index int, t *TraceLine) bool {
+		for len(offsets) < index {
+			offsets = append(offsets, ^uint64(0))
+		}
+		if first == nil {
+			first = t
+		}
+		offsets = append(offsets, t.Offset)
+		return true
+	})
+	return offsets, first, err
+}
+
+// DiffTraces 按指令偏移对齐两条 trace：相同的部分逐行对应，遇到不同时在前方窗口内
+// 寻找代价（两边跳过的行数之和）最小、之后连续 diffResyncMatch 条相同的位置重新对齐
+func DiffTraces(a, b *TraceManager) (*TraceDiff, error) {
+	offA, firstA, err := traceOffsets(a)
+	if err != nil {
+		return nil, err
+	}
+	offB, firstB, err := traceOffsets(b)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &TraceDiff{LenA: len(offA), LenB: len(offB)}
+	if firstA != nil && firstB != nil {
+		d.CodeDelta = (firstA.Addr - firstA.Offset) - (firstB.Addr - firstB.Offset)
+		d.StackDelta = firstA.SP - firstB.SP
+	}
+
+	add := func(s *DiffSegment) {
+		if s.LenA == 0 && s.LenB == 0 {
+			return
+		}
+		if n := len(d.Segments); n > 0 {
+			s.row = d.Segments[n-1].row + d.Segments[n-1].rows()
+		}
+		d.Segments = append(d.Segments, s)
+	}
+
+	i, j := 0, 0
+	for i < len(offA) && j < len(offB) {
+		startA, startB := i, j
+		for i < len(offA) && j < len(offB) && offA[i] == offB[j] {
+			i++
+			j++
+		}
+		add(&DiffSegment{A: startA, B: startB, LenA: i - startA, LenB: i - startA, Aligned: true})
+		if i == len(offA) || j == len(offB) {
+			break
+		}
+
+		ra, rb, ok := resync(offA, offB, i, j)
+		if !ok || len(d.Segments) >= 2*maxDiffDivergences {
+			break
+		}
+		add(&DiffSegment{A: i, B: j, LenA: ra - i, LenB: rb - j})
+		i, j = ra, rb
+	}
+	// 剩下的部分没有对齐
+	add(&DiffSegment{A: i, B: j, LenA: len(offA) - i, LenB: len(offB) - j})
+
+	if err := d.findRegisterDiff(a, b); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// resync 从分叉处 (i, j) 向前寻找重新对齐的位置
+func resync(offA, offB []uint64, i, j int) (int, int, bool) {
+	positions := make(map[uint64][]int)
+	for k := j; k < len(offB) && k < j+diffResyncWindow; k++ {
+		positions[offB[k]] = append(positions[offB[k]], k)
+	}
+	matches := func(ra, rb int) bool {
+		for k := 0; k < diffResyncMatch; k++ {
+			if ra+k >= len(offA) || rb+k >= len(offB) {
+				// 到结尾为止都相同也算
+				return ra+k == len(offA) && rb+k == len(offB)
+			}
+			if offA[ra+k] != offB[rb+k] {
+				return false
+			}
+		}
+		return true
+	}
+
+	best, ra, rb := -1, 0, 0
+	for k := 0; k < diffResyncWindow && i+k < len(offA); k++ {
+		if best >= 0 && k >= best {
+			break
+		}
+		for _, p := range positions[offA[i+k]] {
+			cost := k + p - j
+			if (best < 0 || cost < best) && matches(i+k, p) {
+				best, ra, rb = cost, i+k, p
+			}
+		}
+	}
+	return ra, rb, best >= 0
+}
+
+// SameValue 比较两次执行中的寄存器值，相差模块基址或栈基址的指针视为相同
+func (d *TraceDiff) SameValue(va, vb uint64) bool {
+	return va == vb || d.CodeDelta != 0 && va-vb == d.CodeDelta || d.StackDelta != 0 && va-vb == d.StackDelta
+}
+
+// findRegisterDiff 同时扫描两条 trace，在第一段对齐的指令中找出第一个取值不同的寄存器
+func (d *TraceDiff) findRegisterDiff(a, b *TraceManager) error {
+	if len(d.Segments) == 0 || !d.Segments[0].Aligned {
+		return nil
+	}
+	seg := d.Segments[0]
+
+	type item struct {
+		index int
+		t     *TraceLine
+	}
+	lines := make(chan item, 256)
+	done := make(chan struct{})
+	errB := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		errB <- b.Scan(func(index int, t *TraceLine) bool {
+			if index >= seg.B+seg.LenB {
+				return false
+			}
+			select {
+			case lines <- item{index, t}:
+				return true
+			case <-done:
+				return false
+			}
+		})
+	}()
+
+	cur := item{index: -1}
+	err := a.Scan(func(i int, ta *TraceLine) bool {
+		if i >= seg.A+seg.LenA {
+			return false
+		}
+		j := seg.B + (i - seg.A)
+		for cur.index < j {
+			next, ok := <-lines
+			if !ok {
+				return false
+			}
+			cur = next
+		}
+		if cur.index != j {
+			return true
+		}
+		tb := cur.t
+		for r := 0; r < 31; r++ {
+			if !d.SameValue(ta.Regs[r], tb.Regs[r]) {
+				d.FirstRegDiff = &RegDiff{A: i, B: j, Reg: fmt.Sprintf("x%d", r), ValueA: ta.Regs[r], ValueB: tb.Regs[r]}
+				return false
+			}
+		}
+		if !d.SameValue(ta.SP, tb.SP) {
+			d.FirstRegDiff = &RegDiff{A: i, B: j, Reg: "sp", ValueA: ta.SP, ValueB: tb.SP}
+			return false
+		}
+		return true
+	})
+	close(done)
+	if e := <-errB; err == nil {
+		err = e
+	}
+	return err
+}
+
+// Divergences 返回控制流分叉的段
+func (d *TraceDiff) Divergences() []*DiffSegment {
+	var divs []*DiffSegment
+	for _, s := range d.Segments {
+		if !s.Aligned {
+			divs = append(divs, s)
+		}
+	}
+	return divs
+}
+
+// Rows 返回并排视图的总行数
+func (d *TraceDiff) Rows() int {
+	if n := len(d.Segments); n > 0 {
+		return d.Segments[n-1].row + d.Segments[n-1].rows()
+	}
+	return 0
+}
+
+// segmentAt 返回包含第 row 行的段
+func (d *TraceDiff) segmentAt(row int) *DiffSegment {
+	i := sort.Search(len(d.Segments), func(i int) bool { return d.Segments[i].row > row }) - 1
+	if i < 0 {
+		return nil
+	}
+	return d.Segments[i]
+}
+
+// Row 返回并排视图第 row 行两边的行号，某一边没有对应的行时为 -1
+func (d *TraceDiff) Row(row int) (a, b int, aligned bool) {
+	s := d.segmentAt(row)
+	if s == nil || row >= d.Rows() {
+		return -1, -1, false
+	}
+	k := row - s.row
+	a, b = -1, -1
+	if k < s.LenA {
+		a = s.A + k
+	}
+	if k < s.LenB {
+		b = s.B + k
+	}
+	return a, b, s.Aligned
+}
+
+// RowOfA 返回 A 中第 index 行所在的并排视图行
+func (d *TraceDiff) RowOfA(index int) int {
+	for _, s := range d.Segments {
+		if index >= s.A && index < s.A+s.LenA {
+			return s.row + index - s.A
+		}
+	}
+	return -1
+}
+
+// NextDivergence 返回第 row 行之后（forward 为 false 时为之前）第一个分叉段的起始行，没有时返回 -1
+func (d *TraceDiff) NextDivergence(row int, forward bool) int {
+	if forward {
+		for _, s := range d.Segments {
+			if !s.Aligned && s.row > row {
+				return s.row
+			}
+		}
+		return -1
+	}
+	for i := len(d.Segments) - 1; i >= 0; i-- {
+		if s := d.Segments[i]; !s.Aligned && s.row < row {
+			return s.row
+		}
+	}
+	return -1
+}
+
+// collectLines 扫描一遍 trace 取出 wanted 中的各行，不改变加载窗口
+func collectLines(tm *TraceManager, wanted map[int]bool) map[int]*TraceLine {
+	lines := make(map[int]*TraceLine, len(wanted))
+	if len(wanted) == 0 {
+		return lines
+	}
+	// 读取失败时缺少的行只显示行号
+	tm.Scan(func(index int, t *TraceLine) bool {
+		if wanted[index] {
+			lines[index] = t
+		}
+		return len(lines) < len(wanted)
+	})
+	return lines
+}
+
+// describeLine 返回第 index 行的简短描述
+func describeLine(lines map[int]*TraceLine, index int) string {
+	if index < 0 {
+		return "(end)"
+	}
+	t := lines[index]
+	if t == nil {
+		return fmt.Sprintf("line %d", index)
+	}
+	return fmt.Sprintf("line %d  0x%x (+0x%x)  %s", index, t.Addr, t.Offset, t.Instr)
+}
+
+// Format 生成文本报告：ASLR 偏移、第一个寄存器差异以及最多 limit 个控制流分叉
+func (d *TraceDiff) Format(a, b *TraceManager, limit int) string {
+	divs := d.Divergences()
+	shown := divs
+	if len(shown) > limit {
+		shown = shown[:limit]
+	}
+
+	// 报告中用到的行先各扫描一遍取出，避免逐行重新加载窗口
+	wantA, wantB := make(map[int]bool), make(map[int]bool)
+	want := func(set map[int]bool, total int, indices ...int) {
+		for _, i := range indices {
+			if i >= 0 && i < total {
+				set[i] = true
+			}
+		}
+	}
+	if r := d.FirstRegDiff; r != nil {
+		want(wantA, d.LenA, r.A-1, r.A)
+	}
+	for _, s := range shown {
+		want(wantA, d.LenA, s.A-1, s.A)
+		want(wantB, d.LenB, s.B)
+	}
+	linesA, linesB := collectLines(a, wantA), collectLines(b, wantB)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("A: %s (%d lines)\nB: %s (%d lines)\n", a.FileName, d.LenA, b.FileName, d.LenB))
+	sb.WriteString(fmt.Sprintf("Module base delta %s, stack delta %s (A - B)\n\n", SignedHex(d.CodeDelta), SignedHex(d.StackDelta)))
+
+	if r := d.FirstRegDiff; r != nil {
+		sb.WriteString(fmt.Sprintf("First register difference: %s = 0x%x (A) vs 0x%x (B)\n", r.Reg, r.ValueA, r.ValueB))
+		if r.A > 0 {
+			sb.WriteString(fmt.Sprintf("  written by A %s\n", describeLine(linesA, r.A-1)))
+		}
+		sb.WriteString(fmt.Sprintf("  before     A %s\n\n", describeLine(linesA, r.A)))
+	} else {
+		sb.WriteString("No register difference before the first control-flow divergence\n\n")
+	}
+
+	if len(divs) == 0 {
+		sb.WriteString("Control flow is identical\n")
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf("%d control-flow divergences\n", len(divs)))
+	for n, s := range shown {
+		sb.WriteString(fmt.Sprintf("\n#%d  A %d-%d (%d lines) | B %d-%d (%d lines)\n",
+			n+1, s.A, s.A+s.LenA-1, s.LenA, s.B, s.B+s.LenB-1, s.LenB))
+		if s.A > 0 {
+			sb.WriteString(fmt.Sprintf("  last common  A %s\n", describeLine(linesA, s.A-1)))
+		}
+		sb.WriteString(fmt.Sprintf("  A goes to    %s\n", describeLine(linesA, endOr(s.A, d.LenA))))
+		sb.WriteString(fmt.Sprintf("  B goes to    %s\n", describeLine(linesB, endOr(s.B, d.LenB))))
+	}
+	if len(divs) > len(shown) {
+		sb.WriteString(fmt.Sprintf("  ... %d more\n", len(divs)-len(shown)))
+	}
+	return sb.String()
+}
+
+// SignedHex 把两个地址之差按有符号数格式化
+func SignedHex(delta uint64) string {
+	if int64(delta) < 0 {
+		return fmt.Sprintf("-0x%x", -delta)
+	}
+	return fmt.Sprintf("0x%x", delta)
+}
+
+// endOr 在 index 超出 trace 结尾时返回 -1
+func endOr(index, total int) int {
+	if index >= total {
+		return -1
+	}
+	return index
+}
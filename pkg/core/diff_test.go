@@ -0,0 +1,130 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+// diffTrace 构造一条内存中的 trace，第 i 行位于模块基址 base 之后 offsets[i] 处
+func diffTrace(base uint64, offsets ...uint64) *TraceManager {
+	tm := NewTraceManager()
+	for i, off := range offsets {
+		tm.AddInstruction(&TraceLine{Step: uint32(i), Addr: base + off, Offset: off, Instr: "nop", SP: 0x7fff0000})
+	}
+	return tm
+}
+
+func TestDiffTraces(t *testing.T) {
+	type row struct {
+		row, a, b int
+		aligned   bool
+	}
+	tests := []struct {
+		name     string
+		a, b     *TraceManager
+		segments []DiffSegment
+		rows     []row // 并排视图中抽查的行
+		rowOfA   map[int]int
+	}{
+		{
+			name:     "identical",
+			a:        diffTrace(0x1000, 0, 4, 8, 12),
+			b:        diffTrace(0x1000, 0, 4, 8, 12),
+			segments: []DiffSegment{{A: 0, B: 0, LenA: 4, LenB: 4, Aligned: true}},
+			rows:     []row{{0, 0, 0, true}, {3, 3, 3, true}, {4, -1, -1, false}},
+			rowOfA:   map[int]int{3: 3, 4: -1},
+		},
+		{
+			// B 多执行了两条指令，之后重新对齐
+			name: "divergence with resync",
+			a:    diffTrace(0x1000, 0, 4, 8, 12, 16, 20, 24, 28),
+			b:    diffTrace(0x1000, 0, 4, 100, 104, 8, 12, 16, 20, 24, 28),
+			segments: []DiffSegment{
+				{A: 0, B: 0, LenA: 2, LenB: 2, Aligned: true},
+				{A: 2, B: 2, LenA: 0, LenB: 2},
+				{A: 2, B: 4, LenA: 6, LenB: 6, Aligned: true},
+			},
+			rows:   []row{{1, 1, 1, true}, {2, -1, 2, false}, {3, -1, 3, false}, {4, 2, 4, true}, {9, 7, 9, true}},
+			rowOfA: map[int]int{1: 1, 2: 4, 7: 9},
+		},
+		{
+			// 分叉后再也没有对齐
+			name: "tail divergence",
+			a:    diffTrace(0x1000, 0, 4, 8, 12),
+			b:    diffTrace(0x1000, 0, 4, 200, 204, 208),
+			segments: []DiffSegment{
+				{A: 0, B: 0, LenA: 2, LenB: 2, Aligned: true},
+				{A: 2, B: 2, LenA: 2, LenB: 3},
+			},
+			rows:   []row{{2, 2, 2, false}, {3, 3, 3, false}, {4, -1, 4, false}, {5, -1, -1, false}},
+			rowOfA: map[int]int{3: 3},
+		},
+		{
+			// 两次执行的模块基址不同，偏移相同
+			name:     "aslr",
+			a:        diffTrace(0x7f00001000, 0, 4, 8),
+			b:        diffTrace(0x7f80001000, 0, 4, 8),
+			segments: []DiffSegment{{A: 0, B: 0, LenA: 3, LenB: 3, Aligned: true}},
+			rows:     []row{{2, 2, 2, true}},
+		},
+	}
+
+	for _, tt := range tests {
+		d, err := DiffTraces(tt.a, tt.b)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(d.Segments) != len(tt.segments) {
+			t.Errorf("%s: got %d segments, want %d", tt.name, len(d.Segments), len(tt.segments))
+			continue
+		}
+		for i, want := range tt.segments {
+			got := *d.Segments[i]
+			got.row = 0
+			if got != want {
+				t.Errorf("%s: segment %d: got %+v, want %+v", tt.name, i, got, want)
+			}
+		}
+		for _, r := range tt.rows {
+			if a, b, aligned := d.Row(r.row); a != r.a || b != r.b || aligned != r.aligned {
+				t.Errorf("%s: Row(%d) = %d, %d, %v, want %d, %d, %v", tt.name, r.row, a, b, aligned, r.a, r.b, r.aligned)
+			}
+		}
+		for index, want := range tt.rowOfA {
+			if got := d.RowOfA(index); got != want {
+				t.Errorf("%s: RowOfA(%d) = %d, want %d", tt.name, index, got, want)
+			}
+		}
+	}
+}
+
+func TestDiffTracesASLR(t *testing.T) {
+	a := diffTrace(0x7f00001000, 0, 4, 8)
+	b := diffTrace(0x7f80001000, 0, 4, 8)
+	// 指向各自模块的指针扣除基址之差后相同，x2 才是真正的差异
+	a.Instructions[1].Regs[1], b.Instructions[1].Regs[1] = 0x7f00001800, 0x7f80001800
+	a.Instructions[2].Regs[1], b.Instructions[2].Regs[1] = 0x7f00001800, 0x7f80001800
+	a.Instructions[2].Regs[2], b.Instructions[2].Regs[2] = 1, 2
+
+	d, err := DiffTraces(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if SignedHex(d.CodeDelta) != "-0x80000000" {
+		t.Errorf("CodeDelta %s, want -0x80000000", SignedHex(d.CodeDelta))
+	}
+	if !d.SameValue(0x7f00001800, 0x7f80001800) || d.SameValue(1, 2) {
+		t.Errorf("SameValue does not account for the module delta")
+	}
+	want := RegDiff{A: 2, B: 2, Reg: "x2", ValueA: 1, ValueB: 2}
+	if d.FirstRegDiff == nil || *d.FirstRegDiff != want {
+		t.Fatalf("FirstRegDiff %+v, want %+v", d.FirstRegDiff, want)
+	}
+
+	report := d.Format(a, b, 20)
+	for _, s := range []string{"First register difference: x2 = 0x1 (A) vs 0x2 (B)", "written by A line 1  0x7f00001004", "Control flow is identical"} {
+		if !strings.Contains(report, s) {
+			t.Errorf("report does not contain %q:\n%s", s, report)
+		}
+	}
+}
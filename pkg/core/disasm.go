@@ -0,0 +1,64 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/arch/arm64/arm64asm"
+)
+
+// pcRelPattern 匹配 arm64asm 输出的相对地址 ".+0x10"（负数以补码表示）
+var pcRelPattern = regexp.MustCompile(`\.\+0x[0-9a-f]+`)
+
+// Disassemble 把 4 字节机器码反汇编为与 trace 相同风格的文本，
+// pc 为指令地址，相对跳转的目标换算成绝对地址（如 "bl #0x7fda102000"）
+// 无法识别的机器码显示为 ".inst 0x..."
+func Disassemble(opcode uint32, pc uint64) string {
+	var code [4]byte
+	binary.LittleEndian.PutUint32(code[:], opcode)
+	inst, err := arm64asm.Decode(code[:])
+	if err != nil {
+		return fmt.Sprintf(".inst 0x%08x", opcode)
+	}
+
+	base := pc
+	if inst.Op == arm64asm.ADRP {
+		base &^= 0xfff
+	}
+	return pcRelPattern.ReplaceAllStringFunc(arm64asm.GNUSyntax(inst), func(rel string) string {
+		delta, _ := strconv.ParseUint(rel[len(".+0x"):], 16, 64)
+		return fmt.Sprintf("#0x%x", base+delta)
+	})
+}
+
+// parseOpcode 解析机器码列，如 "d10043ff"、"0xd10043ff"
+// 只接受不带引号的 8 位十六进制数，避免把指令文本误认为机器码
+func parseOpcode(field string) (uint32, bool) {
+	field = strings.TrimPrefix(strings.TrimSpace(field), "0x")
+	if len(field) != 8 {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(field, 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(v), true
+}
+
+// looksLikeOpcode 报告字段是否像一个位数不对的机器码：不带引号、只有十六进制数字
+// 指令文本总带有空格或非十六进制字母（ret、nop），不会被误判
+func looksLikeOpcode(field string) bool {
+	field = strings.TrimPrefix(strings.TrimSpace(field), "0x")
+	if field == "" {
+		return false
+	}
+	for _, c := range field {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
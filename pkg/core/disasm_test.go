@@ -0,0 +1,101 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	tests := []struct {
+		opcode uint32
+		pc     uint64
+		want   string
+	}{
+		{0xd65f03c0, 0x1000, "ret"},
+		{0xd10043ff, 0x1000, "sub sp, sp, #0x10"},
+		{0x94000004, 0x1000, "bl #0x1010"},
+		{0x97ffffff, 0x1000, "bl #0xffc"},
+		// adrp 以所在页为基准
+		{0x90000001, 0x1234, "adrp x1, #0x1000"},
+		{0xffffffff, 0x1000, ".inst 0xffffffff"},
+	}
+	for _, tt := range tests {
+		if got := Disassemble(tt.opcode, tt.pc); got != tt.want {
+			t.Errorf("Disassemble(0x%08x, 0x%x) = %q, want %q", tt.opcode, tt.pc, got, tt.want)
+		}
+	}
+}
+
+func TestParseOpcode(t *testing.T) {
+	tests := []struct {
+		field string
+		want  uint32
+		ok    bool
+	}{
+		{"d65f03c0", 0xd65f03c0, true},
+		{" 0xd65f03c0 ", 0xd65f03c0, true},
+		{`"ret"`, 0, false},
+		{"d65f03c", 0, false},
+		{"d65f03c0c", 0, false},
+		{"zzzzzzzz", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseOpcode(tt.field)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseOpcode(%q) = 0x%x, %v, want 0x%x, %v", tt.field, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// traceLine 拼出一行 trace：head 为寄存器之前的字段，寄存器依次为 x0-x30、sp、pc
+func traceLine(head ...string) string {
+	fields := append([]string{}, head...)
+	for i := 0; i < 31; i++ {
+		fields = append(fields, fmt.Sprintf("0x%x", i))
+	}
+	return strings.Join(append(fields, "0x7fff0000", "0x1000"), "|")
+}
+
+func TestParseLineOpcode(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		instr     string
+		opcode    uint32
+		hasOpcode bool
+	}{
+		{"text only", traceLine("1", "0x1000", "0x0", `"mov x0, x1"`), "mov x0, x1", 0, false},
+		{"opcode only", traceLine("1", "0x1000", "0x0", "d65f03c0"), "ret", 0xd65f03c0, true},
+		{"opcode and empty text", traceLine("1", "0x1000", "0x0", "94000004", `""`), "bl #0x1010", 0x94000004, true},
+		{"opcode and text", traceLine("1", "0x1000", "0x0", "d65f03c0", `"ret x30"`), "ret x30", 0xd65f03c0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLine(tt.line)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got.Instr != tt.instr || got.Opcode != tt.opcode || got.HasOpcode != tt.hasOpcode {
+			t.Errorf("%s: got %q 0x%x %v, want %q 0x%x %v", tt.name,
+				got.Instr, got.Opcode, got.HasOpcode, tt.instr, tt.opcode, tt.hasOpcode)
+		}
+		if got.Regs[30] != 30 || got.SP != 0x7fff0000 || got.PC != 0x1000 {
+			t.Errorf("%s: registers shifted: x30 0x%x sp 0x%x pc 0x%x", tt.name, got.Regs[30], got.SP, got.PC)
+		}
+	}
+
+	// 机器码格式不对要报错，不能当成指令文本或别的指令
+	for _, line := range []string{
+		traceLine("1", "0x1000", "0x0", "d65f03"),
+		traceLine("1", "0x1000", "0x0", "0xd65f03c0c"),
+		traceLine("1", "0x1000", "0x0", "d65f03", `"ret"`),
+		traceLine("1", "0x1000", "0x0", `"ret"`, `"ret"`),
+		traceLine("1", "0x1000", "0x0", "xyzw03c0", `""`),
+	} {
+		if got, err := ParseLine(line); err == nil {
+			t.Errorf("%q: parsed as %q, want an error", line, got.Instr)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Examine 是一条 gdb 风格的 x/NFU 命令，每一步都会按当前寄存器重新计算地址
+type Examine struct {
+	Expr   string
+	Count  int
+	Format byte // x d u o t c s a
+	Unit   int  // 1 2 4 8
+}
+
+// ParseExamine 解析 "x/32xb 0x7fda1a4228"、"x/4gx $sp"、"x/s $x0"
+// prev 为上一次的设置，省略的部分沿用 prev（与 gdb 相同）
+func ParseExamine(spec, expr string, prev *Examine) (*Examine, error) {
+	e := &Examine{Count: 1, Format: 'x', Unit: 8}
+	if prev != nil {
+		e.Format, e.Unit = prev.Format, prev.Unit
+	}
+	e.Expr = strings.TrimSpace(expr)
+	if e.Expr == "" {
+		if prev == nil {
+			return nil, fmt.Errorf("Usage: x/NFU <address expression>")
+		}
+		e.Expr = prev.Expr
+	}
+
+	spec = strings.TrimPrefix(spec, "/")
+	digits := 0
+	for digits < len(spec) && spec[digits] >= '0' && spec[digits] <= '9' {
+		digits++
+	}
+	if digits > 0 {
+		n, _ := strconv.Atoi(spec[:digits])
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid count %q", spec[:digits])
+		}
+		e.Count = n
+	}
+
+	for _, c := range spec[digits:] {
+		switch c {
+		case 'b':
+			e.Unit = 1
+		case 'h':
+			e.Unit = 2
+		case 'w':
+			e.Unit = 4
+		case 'g':
+			e.Unit = 8
+		case 'x', 'd', 'u', 'o', 't', 'c', 's', 'a':
+			e.Format = byte(c)
+		default:
+			return nil, fmt.Errorf("invalid format letter %q", c)
+		}
+	}
+	switch e.Format {
+	case 'c':
+		e.Unit = 1
+	case 'a':
+		e.Unit = 8
+	}
+	return e, nil
+}
+
+// perLine 返回每行显示的单元数（与 gdb 相同）
+func (e *Examine) perLine() int {
+	if e.Format == 'a' {
+		return 1
+	}
+	switch e.Unit {
+	case 1:
+		return 8
+	case 2:
+		return 8
+	case 4:
+		return 4
+	}
+	return 2
+}
+
+// maxString 是 x/s 单个字符串显示的最大长度
+const maxString = 200
+
+// Render 在 step 时的影子内存上执行 examine，未知字节显示为 ??，written 中的地址高亮
+func (e *Examine) Render(mem *ShadowMemory, t *TraceLine, step int, written func(addr uint64) bool) (string, error) {
+	addr, err := EvalExpr(e.Expr, t)
+	if err != nil {
+		return "", err
+	}
+
+	unit := unitLetter(e.Unit)
+	if e.Format == 's' || e.Format == 'c' {
+		unit = ""
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[green]x/%d%c%s %s = 0x%x @ step %d[-]\n",
+		e.Count, e.Format, unit, escapeTags(e.Expr), addr, step))
+
+	if e.Format == 's' {
+		for i := 0; i < e.Count; i++ {
+			var str strings.Builder
+			n := 0
+			for ; n < maxString; n++ {
+				b, ok := mem.ByteAt(addr+uint64(n), step)
+				if !ok {
+					str.WriteString("[gray]??[-]")
+					break
+				}
+				if b == 0 {
+					break
+				}
+				str.WriteString(escapeTags(quoteByte(b)))
+			}
+			sb.WriteString(fmt.Sprintf("0x%012x: \"%s\"\n", addr, str.String()))
+			addr += uint64(n + 1)
+		}
+		return sb.String(), nil
+	}
+
+	perLine := e.perLine()
+	var derefs []string
+	for i := 0; i < e.Count; i++ {
+		if i%perLine == 0 {
+			if i > 0 {
+				writeDerefs(&sb, derefs)
+				derefs = derefs[:0]
+				sb.WriteString("\n")
+			}
+			sb.WriteString(fmt.Sprintf("0x%012x:", addr))
+		}
+
+		data, known := mem.Read(addr, e.Unit, step)
+		item := e.formatUnit(data, known)
+
+		// 8 字节单元按指针解引用
+		if e.Unit == 8 && (e.Format == 'x' || e.Format == 'a') {
+			if v, ok := littleEndian(data, known); ok {
+				if chain := mem.Telescope(v, step); chain != "" {
+					derefs = append(derefs, chain)
+				}
+			}
+		}
+
+		changed := false
+		for j := 0; j < e.Unit; j++ {
+			if known[j] && written(addr+uint64(j)) {
+				changed = true
+			}
+		}
+		if changed {
+			item = "[yellow]" + item + "[-]"
+		}
+		sb.WriteString(" " + item)
+		addr += uint64(e.Unit)
+	}
+	writeDerefs(&sb, derefs)
+	sb.WriteString("\n")
+	return sb.String(), nil
+}
+
+func writeDerefs(sb *strings.Builder, derefs []string) {
+	if len(derefs) > 0 {
+		sb.WriteString(fmt.Sprintf("  [gray]%s[-]", escapeTags(strings.Join(derefs, " | "))))
+	}
+}
+
+// littleEndian 把完全已知的字节按小端序组成整数
+func littleEndian(data []byte, known []bool) (uint64, bool) {
+	var v uint64
+	for i := len(data) - 1; i >= 0; i-- {
+		if !known[i] {
+			return 0, false
+		}
+		v = v<<8 | uint64(data[i])
+	}
+	return v, true
+}
+
+func unitLetter(unit int) string {
+	switch unit {
+	case 1:
+		return "b"
+	case 2:
+		return "h"
+	case 4:
+		return "w"
+	}
+	return "g"
+}
+
+// formatUnit 按格式显示一个单元（小端序）
+func (e *Examine) formatUnit(data []byte, known []bool) string {
+	allKnown := true
+	var v uint64
+	for j := len(data) - 1; j >= 0; j-- {
+		v = v<<8 | uint64(data[j])
+		if !known[j] {
+			allKnown = false
+		}
+	}
+
+	if e.Format == 'c' {
+		if !known[0] {
+			return "[gray]??[-]"
+		}
+		return fmt.Sprintf("%3d '%s'", data[0], escapeTags(quoteByte(data[0])))
+	}
+
+	// 十六进制可以按字节显示部分未知的值
+	if e.Format == 'x' || e.Format == 'a' {
+		var sb strings.Builder
+		sb.WriteString("0x")
+		for j := len(data) - 1; j >= 0; j-- {
+			if known[j] {
+				sb.WriteString(fmt.Sprintf("%02x", data[j]))
+			} else {
+				sb.WriteString("[gray]??[-]")
+			}
+		}
+		return sb.String()
+	}
+
+	if !allKnown {
+		return "[gray]??[-]"
+	}
+	switch e.Format {
+	case 'd':
+		shift := uint(64 - 8*len(data))
+		return strconv.FormatInt(int64(v<<shift)>>shift, 10)
+	case 'u':
+		return strconv.FormatUint(v, 10)
+	case 'o':
+		return "0" + strconv.FormatUint(v, 8)
+	case 't':
+		return fmt.Sprintf("%0*b", 8*len(data), v)
+	}
+	return fmt.Sprintf("0x%x", v)
+}
+
+// quoteByte 返回字节的可打印形式
+func quoteByte(b byte) string {
+	switch b {
+	case '\n':
+		return `\n`
+	case '\t':
+		return `\t`
+	case '"':
+		return `\"`
+	case '\\':
+		return `\\`
+	}
+	if b >= 0x20 && b < 0x7f {
+		return string(rune(b))
+	}
+	return fmt.Sprintf(`\x%02x`, b)
+}
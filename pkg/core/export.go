@@ -0,0 +1,210 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CallNode 是调用图中的一个函数
+type CallNode struct {
+	Entry uint64
+	Name  string
+	Calls int // 被调用的次数，trace 顶层为 0
+}
+
+// CallGraph 是由影子调用栈得到的动态调用图
+type CallGraph struct {
+	Root  uint64
+	Nodes map[uint64]*CallNode
+	Edges EdgeSet // 调用者入口 -> 被调函数入口
+}
+
+// BuildCallGraph 汇总所有调用帧，函数名取自 BL 日志
+func BuildCallGraph(tm *TraceManager) (*CallGraph, error) {
+	cs, err := tm.CallStack()
+	if err != nil {
+		return nil, err
+	}
+
+	cg := &CallGraph{Nodes: make(map[uint64]*CallNode), Edges: make(EdgeSet)}
+	err = tm.Scan(func(index int, t *TraceLine) bool {
+		cg.Root = t.Addr
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	cg.Nodes[cg.Root] = &CallNode{Entry: cg.Root, Name: fmt.Sprintf("sub_%x", cg.Root)}
+
+	frames := cs.Frames()
+	for _, f := range frames {
+		node := cg.Nodes[f.Target]
+		if node == nil {
+			node = &CallNode{Entry: f.Target, Name: f.Name()}
+			cg.Nodes[f.Target] = node
+		}
+		node.Calls++
+
+		caller := cg.Root
+		if f.parent >= 0 {
+			caller = frames[f.parent].Target
+		}
+		cg.Edges.add(caller, f.Target)
+	}
+	return cg, nil
+}
+
+// label 返回节点的地址和调用次数，trace 顶层标记为 root
+func (n *CallNode) label() string {
+	if n.Calls == 0 {
+		return fmt.Sprintf("0x%x (root)", n.Entry)
+	}
+	return fmt.Sprintf("0x%x (x%d)", n.Entry, n.Calls)
+}
+
+// sortedNodes 返回按入口地址排序的函数
+func (cg *CallGraph) sortedNodes() []*CallNode {
+	nodes := make([]*CallNode, 0, len(cg.Nodes))
+	for _, n := range cg.Nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Entry < nodes[j].Entry })
+	return nodes
+}
+
+// DOT 以 Graphviz 格式导出调用图，边上标注调用次数
+func (cg *CallGraph) DOT() string {
+	var sb strings.Builder
+	sb.WriteString("digraph callgraph {\n")
+	sb.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	for _, n := range cg.sortedNodes() {
+		sb.WriteString(fmt.Sprintf("\tf%x [label=\"%s\\n%s\"];\n", n.Entry, dotEscape(n.Name), n.label()))
+	}
+	for _, e := range cg.Edges.Sorted() {
+		sb.WriteString(fmt.Sprintf("\tf%x -> f%x [label=\"%d\"];\n", e.From, e.To, e.Count))
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Mermaid 以 Mermaid flowchart 格式导出调用图
+func (cg *CallGraph) Mermaid() string {
+	var sb strings.Builder
+	sb.WriteString("flowchart TD\n")
+	for _, n := range cg.sortedNodes() {
+		sb.WriteString(fmt.Sprintf("    f%x[\"%s<br/>%s\"]\n", n.Entry, mermaidEscape(n.Name), n.label()))
+	}
+	for _, e := range cg.Edges.Sorted() {
+		sb.WriteString(fmt.Sprintf("    f%x -->|%d| f%x\n", e.From, e.Count, e.To))
+	}
+	return sb.String()
+}
+
+// exportEntries 返回要导出的函数入口：entry 为 0 时导出全部
+func (g *CFG) exportEntries(entry uint64) []uint64 {
+	if entry != 0 {
+		return []uint64{entry}
+	}
+	entries := make([]uint64, 0, len(g.Functions))
+	for e := range g.Functions {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i] < entries[j] })
+	return entries
+}
+
+// exportCalls 返回两端都在导出范围内的调用边
+func (g *CFG) exportCalls(entry uint64) []*CFGEdge {
+	var calls []*CFGEdge
+	for _, e := range g.Calls.Sorted() {
+		if entry == 0 || g.Blocks[e.From].Function == entry && g.Blocks[e.To].Function == entry {
+			calls = append(calls, e)
+		}
+	}
+	return calls
+}
+
+// DOT 以 Graphviz 格式导出 CFG，每个函数一个子图，调用画成虚线
+// entry 不为 0 时只导出该函数
+func (g *CFG) DOT(entry uint64) string {
+	var sb strings.Builder
+	sb.WriteString("digraph cfg {\n")
+	sb.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	for _, e := range g.exportEntries(entry) {
+		fg := g.Function(e)
+		sb.WriteString(fmt.Sprintf("\tsubgraph cluster_%x {\n\t\tlabel=\"%s\";\n", e, dotEscape(fg.Name)))
+		for _, b := range fg.Blocks {
+			var label strings.Builder
+			label.WriteString(fmt.Sprintf("0x%x (x%d)\\l", b.Start, b.Count))
+			for _, instr := range b.Instrs {
+				label.WriteString(dotEscape(instr) + "\\l")
+			}
+			sb.WriteString(fmt.Sprintf("\t\tb%x [label=\"%s\"];\n", b.Start, label.String()))
+		}
+		for _, edge := range fg.Edges {
+			sb.WriteString(fmt.Sprintf("\t\tb%x -> b%x [label=\"%d\"];\n", edge.From, edge.To, edge.Count))
+		}
+		sb.WriteString("\t}\n")
+	}
+	for _, c := range g.exportCalls(entry) {
+		sb.WriteString(fmt.Sprintf("\tb%x -> b%x [label=\"%d\", style=dashed];\n", c.From, c.To, c.Count))
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Mermaid 以 Mermaid flowchart 格式导出 CFG，每个函数一个 subgraph，调用画成虚线
+// entry 不为 0 时只导出该函数
+func (g *CFG) Mermaid(entry uint64) string {
+	var sb strings.Builder
+	sb.WriteString("flowchart TD\n")
+	for _, e := range g.exportEntries(entry) {
+		fg := g.Function(e)
+		sb.WriteString(fmt.Sprintf("    subgraph f%x[\"%s\"]\n", e, mermaidEscape(fg.Name)))
+		for _, b := range fg.Blocks {
+			lines := []string{fmt.Sprintf("0x%x (x%d)", b.Start, b.Count)}
+			for _, instr := range b.Instrs {
+				lines = append(lines, mermaidEscape(instr))
+			}
+			sb.WriteString(fmt.Sprintf("        b%x[\"%s\"]\n", b.Start, strings.Join(lines, "<br/>")))
+		}
+		sb.WriteString("    end\n")
+		for _, edge := range fg.Edges {
+			sb.WriteString(fmt.Sprintf("    b%x -->|%d| b%x\n", edge.From, edge.Count, edge.To))
+		}
+	}
+	for _, c := range g.exportCalls(entry) {
+		sb.WriteString(fmt.Sprintf("    b%x -.->|%d| b%x\n", c.From, c.Count, c.To))
+	}
+	return sb.String()
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// mermaidEscape 转义 Mermaid 标签中有特殊含义的字符
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
+
+// ExportFormat 选择导出格式："dot" 或 "mermaid"
+// 没有显式指定时按文件扩展名判断（.mmd/.mermaid 为 Mermaid），默认 DOT
+func ExportFormat(format, path string) (string, error) {
+	switch strings.ToLower(format) {
+	case "dot", "gv":
+		return "dot", nil
+	case "mermaid", "mmd":
+		return "mermaid", nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown format %q (dot or mermaid)", format)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mmd", ".mermaid":
+		return "mermaid", nil
+	}
+	return "dot", nil
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EvalExpr 计算形如 "0x7fda1a4228"、"$sp+0x10"、"$x0-8+$x1" 的地址表达式
+// 寄存器按 t 中的值解析，t 为 nil 时只能使用常量
+func EvalExpr(expr string, t *TraceLine) (uint64, error) {
+	expr = strings.ReplaceAll(expr, " ", "")
+	if expr == "" {
+		return 0, fmt.Errorf("empty expression")
+	}
+
+	var result uint64
+	sign := byte('+')
+	for len(expr) > 0 {
+		// 找到下一个运算符（第一个字符可能是正负号，跳过）
+		end := strings.IndexAny(expr[1:], "+-") + 1
+		if end == 0 {
+			end = len(expr)
+		}
+		term := expr[:end]
+		if term[0] == '+' || term[0] == '-' {
+			sign = term[0]
+			term = term[1:]
+		}
+
+		v, err := evalTerm(term, t)
+		if err != nil {
+			return 0, err
+		}
+		if sign == '-' {
+			result -= v
+		} else {
+			result += v
+		}
+
+		expr = expr[end:]
+		sign = '+'
+	}
+	return result, nil
+}
+
+func evalTerm(term string, t *TraceLine) (uint64, error) {
+	if term == "" {
+		return 0, fmt.Errorf("missing operand")
+	}
+	if v, err := strconv.ParseUint(term, 0, 64); err == nil {
+		return v, nil
+	}
+
+	idx := RegisterIndex(term)
+	if idx < 0 {
+		return 0, fmt.Errorf("invalid operand %q", term)
+	}
+	if t == nil {
+		return 0, fmt.Errorf("no instruction loaded for %s", term)
+	}
+	v := t.RegisterValue(idx)
+	if strings.HasPrefix(strings.ToLower(strings.TrimPrefix(term, "$")), "w") {
+		v &= 0xffffffff
+	}
+	return v, nil
+}
@@ -0,0 +1,243 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FilterRule 是一条过滤规则：Exclude 为 false 时只保留匹配的行，为 true 时隐藏匹配的行
+type FilterRule struct {
+	Kind      string // "addr"、"mnemonic" 或 "module"
+	Exclude   bool
+	Ranges    []ValueRange    // addr
+	Mnemonics map[string]bool // mnemonic
+	Module    uint64          // module：模块基址（Addr - Offset）
+	Name      string          // module：按名字指定时的名字
+}
+
+// ParseFilterRule 解析 filter 的参数，例如 "addr 0x1000-0x5000"、"-mnemonic ldr,str"、"module 0x7fda100000"
+// module 不带基址时取当前行所在的模块，给出名字时按 BL 日志查找
+func ParseFilterRule(args []string, tm *TraceManager) (*FilterRule, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing filter kind")
+	}
+	r := &FilterRule{Kind: args[0]}
+	if strings.HasPrefix(r.Kind, "-") {
+		r.Exclude = true
+		r.Kind = r.Kind[1:]
+	}
+	values := strings.Join(args[1:], ",")
+
+	switch r.Kind {
+	case "addr", "address":
+		r.Kind = "addr"
+		for _, s := range strings.Split(values, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			vr, err := ParseValueRange(s)
+			if err != nil {
+				return nil, err
+			}
+			r.Ranges = append(r.Ranges, vr)
+		}
+		if len(r.Ranges) == 0 {
+			return nil, fmt.Errorf("missing address range")
+		}
+
+	case "mnemonic", "mn":
+		r.Kind = "mnemonic"
+		r.Mnemonics = make(map[string]bool)
+		for _, s := range strings.Split(values, ",") {
+			if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+				r.Mnemonics[s] = true
+			}
+		}
+		if len(r.Mnemonics) == 0 {
+			return nil, fmt.Errorf("missing mnemonic")
+		}
+
+	case "module":
+		if values == "" {
+			current := tm.GetCurrent()
+			if current == nil {
+				return nil, fmt.Errorf("missing module base")
+			}
+			r.Module = current.Addr - current.Offset
+			break
+		}
+		base, err := strconv.ParseUint(values, 0, 64)
+		if err != nil {
+			if base, err = moduleBaseByName(tm, values); err != nil {
+				return nil, err
+			}
+			r.Name = values
+		}
+		r.Module = base
+
+	default:
+		return nil, fmt.Errorf("unknown filter kind %q (addr, mnemonic or module)", r.Kind)
+	}
+	return r, nil
+}
+
+// moduleBaseByName 按 BL 日志中的名字查找模块基址：name 等于函数名，或是 "模块!函数" 中的模块部分，
+// 取这些函数在 trace 中第一次执行时的 Addr - Offset。trace 本身不记录模块名
+func moduleBaseByName(tm *TraceManager, name string) (uint64, error) {
+	targets := make(map[uint64]bool)
+	for _, logs := range tm.LogManager.BlLogs {
+		for _, log := range logs {
+			if log.Function != name && !strings.HasPrefix(log.Function, name+"!") {
+				continue
+			}
+			if addr, err := strconv.ParseUint(strings.TrimSpace(log.Address), 0, 64); err == nil {
+				targets[addr] = true
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return 0, fmt.Errorf("no BL log entry named %q (module names are not recorded in the trace, use the base from vmmap)", name)
+	}
+
+	var base uint64
+	found := false
+	err := tm.Scan(func(index int, t *TraceLine) bool {
+		if targets[t.Addr] {
+			base, found = t.Addr-t.Offset, true
+		}
+		return !found
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("%q is in the BL log but never executed in the trace, use the base from vmmap", name)
+	}
+	return base, nil
+}
+
+// matches 判断指令是否匹配规则（不考虑 Exclude）
+func (r *FilterRule) matches(t *TraceLine) bool {
+	switch r.Kind {
+	case "addr":
+		for _, vr := range r.Ranges {
+			if vr.Contains(t.Addr) {
+				return true
+			}
+		}
+		return false
+	case "mnemonic":
+		return r.Mnemonics[t.Mnemonic()]
+	default:
+		return t.Addr-t.Offset == r.Module
+	}
+}
+
+// Accept 判断指令在这条规则下是否可见
+func (r *FilterRule) Accept(t *TraceLine) bool {
+	return r.matches(t) != r.Exclude
+}
+
+func (r *FilterRule) String() string {
+	var values []string
+	switch r.Kind {
+	case "addr":
+		for _, vr := range r.Ranges {
+			values = append(values, vr.String())
+		}
+	case "mnemonic":
+		for m := range r.Mnemonics {
+			values = append(values, m)
+		}
+		sort.Strings(values)
+	default:
+		values = []string{fmt.Sprintf("0x%x", r.Module)}
+		if r.Name != "" {
+			values[0] = fmt.Sprintf("%s (0x%x)", r.Name, r.Module)
+		}
+	}
+	prefix := ""
+	if r.Exclude {
+		prefix = "-"
+	}
+	return prefix + r.Kind + " " + strings.Join(values, ",")
+}
+
+// Filter 是若干条规则的组合：一行要通过所有规则才可见
+type Filter struct {
+	Rules   []*FilterRule
+	Visible []int // 可见的行，递增
+	Total   int   // trace 的总行数
+}
+
+// NewFilter 按规则扫描 trace，得到可见的行
+func NewFilter(tm *TraceManager, rules []*FilterRule) (*Filter, error) {
+	f := &Filter{Rules: rules}
+	err := tm.Scan(func(index int, t *TraceLine) bool {
+		f.Total = index + 1
+		for _, r := range rules {
+			if !r.Accept(t) {
+				return true
+			}
+		}
+		f.Visible = append(f.Visible, index)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// search 返回第一个不小于 index 的可见行在 Visible 中的位置
+func (f *Filter) search(index int) int {
+	return sort.SearchInts(f.Visible, index)
+}
+
+// Contains 判断第 index 行是否可见，f 为 nil 时所有行都可见
+func (f *Filter) Contains(index int) bool {
+	if f == nil {
+		return true
+	}
+	i := f.search(index)
+	return i < len(f.Visible) && f.Visible[i] == index
+}
+
+// Next 返回 index 之后的第一个可见行，没有时返回 -1
+func (f *Filter) Next(index int) int {
+	if i := f.search(index + 1); i < len(f.Visible) {
+		return f.Visible[i]
+	}
+	return -1
+}
+
+// Prev 返回 index 之前的最后一个可见行，没有时返回 -1
+func (f *Filter) Prev(index int) int {
+	if i := f.search(index); i > 0 {
+		return f.Visible[i-1]
+	}
+	return -1
+}
+
+// Nearest 返回 index 本身或之后的第一个可见行，之后没有时返回之前的最后一个，全部隐藏时返回 -1
+func (f *Filter) Nearest(index int) int {
+	if f.Contains(index) {
+		return index
+	}
+	if i := f.Next(index); i >= 0 {
+		return i
+	}
+	return f.Prev(index)
+}
+
+// Format 列出规则和可见行数
+func (f *Filter) Format() string {
+	var sb strings.Builder
+	for i, r := range f.Rules {
+		sb.WriteString(fmt.Sprintf("%2d  filter %s\n", i+1, r))
+	}
+	sb.WriteString(fmt.Sprintf("\n%d of %d lines visible\n", len(f.Visible), f.Total))
+	return sb.String()
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValueRange 表示闭区间 [Low, High]
+type ValueRange struct {
+	Low  uint64
+	High uint64
+}
+
+// ParseValueRange 解析 "0x10"、"0x10-0x20"（闭区间）或 "0x10+0x8"（起点加长度）
+func ParseValueRange(s string) (ValueRange, error) {
+	s = strings.TrimSpace(s)
+
+	if i := strings.Index(s, "+"); i > 0 {
+		low, err := strconv.ParseUint(s[:i], 0, 64)
+		if err != nil {
+			return ValueRange{}, fmt.Errorf("invalid value %q", s[:i])
+		}
+		size, err := strconv.ParseUint(s[i+1:], 0, 64)
+		if err != nil || size == 0 {
+			return ValueRange{}, fmt.Errorf("invalid length %q", s[i+1:])
+		}
+		return ValueRange{Low: low, High: low + size - 1}, nil
+	}
+
+	if i := strings.Index(s, "-"); i > 0 {
+		low, err := strconv.ParseUint(s[:i], 0, 64)
+		if err != nil {
+			return ValueRange{}, fmt.Errorf("invalid value %q", s[:i])
+		}
+		high, err := strconv.ParseUint(s[i+1:], 0, 64)
+		if err != nil {
+			return ValueRange{}, fmt.Errorf("invalid value %q", s[i+1:])
+		}
+		if high < low {
+			low, high = high, low
+		}
+		return ValueRange{Low: low, High: high}, nil
+	}
+
+	v, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return ValueRange{}, fmt.Errorf("invalid value %q", s)
+	}
+	return ValueRange{Low: v, High: v}, nil
+}
+
+func (r ValueRange) Contains(v uint64) bool {
+	return v >= r.Low && v <= r.High
+}
+
+func (r ValueRange) String() string {
+	if r.Low == r.High {
+		return fmt.Sprintf("0x%x", r.Low)
+	}
+	return fmt.Sprintf("0x%x-0x%x", r.Low, r.High)
+}
+
+// ValueHit 记录某个寄存器开始持有目标值的位置
+type ValueHit struct {
+	LineRef
+	Reg   int    // RegisterIndex 编号
+	Value uint64 // 寄存器的值
+	Lines int    // 连续持有该值的行数
+}
+
+// FindValue 在整个 trace 中查找寄存器值落在 r 内的位置
+// reg 为 -1 时检查所有寄存器；寄存器连续多行持有同一个值只记为一次命中
+func (tm *TraceManager) FindValue(r ValueRange, reg int) ([]ValueHit, error) {
+	regs := []int{reg}
+	if reg < 0 {
+		regs = make([]int, 33)
+		for i := range regs {
+			regs[i] = i
+		}
+	}
+
+	var hits []ValueHit
+	var open [33]int // 每个寄存器当前所在命中的下标，-1 表示没有
+	for i := range open {
+		open[i] = -1
+	}
+
+	err := tm.Scan(func(index int, t *TraceLine) bool {
+		for _, ri := range regs {
+			v := t.RegisterValue(ri)
+			if !r.Contains(v) {
+				open[ri] = -1
+				continue
+			}
+			if h := open[ri]; h != -1 && hits[h].Value == v {
+				hits[h].Lines++
+				continue
+			}
+			hits = append(hits, ValueHit{
+				LineRef: NewLineRef(index, t),
+				Reg:     ri,
+				Value:   v,
+				Lines:   1,
+			})
+			open[ri] = len(hits) - 1
+		}
+		return true
+	})
+	return hits, err
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MemoryAccess 是一次触及某地址范围的读写
+type MemoryAccess struct {
+	LineRef
+	Type    string // "r" 或 "w"
+	Address uint64 // 访问的起始地址
+	Size    int
+	Overlap uint64 // 与查询范围重叠部分的起始地址
+
+	// 重叠部分在这一步之前/之后的内容，Known 标记对应字节是否已知
+	Before      []byte
+	KnownBefore []bool
+	After       []byte
+	KnownAfter  []bool
+
+	HasLine bool // 是否在 trace 中找到了对应的行
+}
+
+// maxAccessSize 是单条指令最多访问的字节数（ldp q 寄存器）
+const maxAccessSize = 32
+
+// MemoryHistory 列出整个 trace 中所有触及 [addr, addr+size) 的读写，按步数排序
+func (tm *TraceManager) MemoryHistory(addr uint64, size uint64) ([]*MemoryAccess, error) {
+	lm := tm.LogManager
+	end := addr + size
+	if end < addr {
+		return nil, fmt.Errorf("range 0x%x+0x%x wraps around the address space", addr, size)
+	}
+
+	// 先按实际地址粗筛，访问大小要等找到指令后才知道
+	type candidate struct {
+		step  int
+		entry *RWLogEntry
+	}
+	var candidates []candidate
+	steps := make(map[int]bool)
+	for step, logs := range lm.RwLogs {
+		for _, log := range logs {
+			ea := log.EffectiveAddress()
+			// 写成差值的形式，避免地址空间顶部的访问加上大小后溢出
+			if ea < end && (ea >= addr || addr-ea < maxAccessSize) {
+				candidates = append(candidates, candidate{step, log})
+				steps[step] = true
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].step < candidates[j].step })
+
+	lines, err := tm.LinesForSteps(steps)
+	if err != nil {
+		return nil, err
+	}
+
+	mem := lm.Memory()
+	var accesses []*MemoryAccess
+	for _, c := range candidates {
+		ref, hasLine := lines[c.step]
+		width := 8
+		if hasLine {
+			if mem := Decode(ref.Instr).Mem; mem != nil {
+				width = mem.Size
+			}
+		}
+
+		ea := c.entry.EffectiveAddress()
+		lo, hi := max(ea, addr), end
+		if ea+uint64(width) > ea {
+			hi = min(ea+uint64(width), end)
+		}
+		if lo >= hi {
+			continue
+		}
+
+		before, knownBefore := mem.Read(lo, int(hi-lo), c.step-1)
+		after, knownAfter := mem.Read(lo, int(hi-lo), c.step)
+
+		if !hasLine {
+			ref = LineRef{Index: -1, Step: uint32(c.step)}
+		}
+		accesses = append(accesses, &MemoryAccess{
+			LineRef:     ref,
+			Type:        c.entry.Type,
+			Address:     ea,
+			Size:        width,
+			Overlap:     lo,
+			Before:      before,
+			KnownBefore: knownBefore,
+			After:       after,
+			KnownAfter:  knownAfter,
+			HasLine:     hasLine,
+		})
+	}
+	return accesses, nil
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -35,6 +36,8 @@ type RWLogEntry struct {
 type LogManager struct {
 	BlLogs map[int][]*BLLogEntry // 按步数索引的 BL 日志
 	RwLogs map[int][]*RWLogEntry // 按步数索引的 RW 日志
+
+	memory *ShadowMemory // 由转储重建的内存，首次使用时构建
 }
 
 func NewLogManager() *LogManager {
@@ -110,6 +113,10 @@ func ParseRWLine(line string) (*RWLogEntry, error) {
 	} else if strings.HasPrefix(content, "(r)") {
 		logType = "r"
 	}
+	if logType != "" {
+		// 去掉类型前缀，否则下面会把 "r)(" 也当成地址的一部分
+		content = content[len("(r)"):]
+	}
 
 	// 提取地址和偏移量
 	startIdx := strings.Index(content, "(")
@@ -135,6 +142,21 @@ func ParseRWLine(line string) (*RWLogEntry, error) {
 	}, nil
 }
 
+// EffectiveAddress 返回访问的实际地址（基址 + 偏移）
+func (e *RWLogEntry) EffectiveAddress() uint64 {
+	base, _ := strconv.ParseUint(e.Address, 0, 64)
+	offset, _ := strconv.ParseUint(e.Offset, 0, 64)
+	return base + offset
+}
+
+// Memory 返回（必要时构建）影子内存
+func (lm *LogManager) Memory() *ShadowMemory {
+	if lm.memory == nil {
+		lm.memory = BuildShadowMemory(lm)
+	}
+	return lm.memory
+}
+
 // LoadBLLog 加载 BL 日志文件
 func (lm *LogManager) LoadBLLog(filename string) error {
 	file, err := os.Open(filename)
@@ -142,6 +164,7 @@ func (lm *LogManager) LoadBLLog(filename string) error {
 		return err
 	}
 	defer file.Close()
+	lm.memory = nil
 
 	scanner := bufio.NewScanner(file)
 	var currentEntry *BLLogEntry
@@ -195,6 +218,7 @@ func (lm *LogManager) LoadRWLog(filename string) error {
 		return err
 	}
 	defer file.Close()
+	lm.memory = nil
 
 	scanner := bufio.NewScanner(file)
 	var currentEntry *RWLogEntry
@@ -280,3 +304,13 @@ func (lm *LogManager) GetRWLogsForStep(step int) []*RWLogEntry {
 
 	return nearestLogs
 }
+
+// CompanionLogs 返回与 trace 配套的 BL/RW 日志路径：
+// 文件名以 code.log 结尾的 trace 对应同目录下的 bl.log 和 rw.log，其他 trace 没有配套日志
+func CompanionLogs(traceFile string) (blFile, rwFile string, ok bool) {
+	if !strings.HasSuffix(filepath.Base(traceFile), "code.log") {
+		return "", "", false
+	}
+	dir := filepath.Dir(traceFile)
+	return filepath.Join(dir, "bl.log"), filepath.Join(dir, "rw.log"), true
+}
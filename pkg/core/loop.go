@@ -0,0 +1,140 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	maxLoopPeriod     = 4096 // 能识别的最长循环体（指令数）
+	minLoopIterations = 3    // 少于这个迭代次数的重复不算循环
+)
+
+// Loop 是 trace 中一段周期重复的地址序列：同一段指令连续执行了 Iterations 次
+type Loop struct {
+	Head       uint64 // 循环体第一条指令的地址
+	Period     int    // 每次迭代的指令数
+	Start      int    // 第一次迭代的第一行
+	End        int    // 循环退出后的第一行
+	Iterations int    // 完整迭代的次数
+	FirstStep  uint32
+	LastStep   uint32
+}
+
+// Contains 判断第 index 行是否在循环内
+func (l *Loop) Contains(index int) bool {
+	return l != nil && index >= l.Start && index < l.End
+}
+
+// Iteration 返回第 index 行所在的迭代（从 1 开始），退出前不完整的部分算作最后一次迭代
+func (l *Loop) Iteration(index int) int {
+	n := (index-l.Start)/l.Period + 1
+	if n > l.Iterations {
+		n = l.Iterations
+	}
+	return n
+}
+
+// String 返回折叠后显示的摘要
+func (l *Loop) String() string {
+	return fmt.Sprintf("loop @0x%x ×%d iterations (steps %d–%d)", l.Head, l.Iterations, l.FirstStep, l.LastStep)
+}
+
+// DetectLoops 扫描 trace，找出地址序列按固定周期重复的区间：
+// 某个地址在 maxLoopPeriod 行内再次出现时，以两次出现的距离为周期，
+// 之后每一行的地址都与一个周期前相同则循环继续，直到第一次不同为止
+// 嵌套循环只识别最内层，得到的循环按位置排序、互不重叠
+func DetectLoops(tm *TraceManager) ([]*Loop, error) {
+	var loops []*Loop
+	var ring [maxLoopPeriod + 1]uint64 // 最近的地址，按行号取模
+	var steps [maxLoopPeriod + 1]uint32
+	lastSeen := make(map[uint64]int)
+	period, start, lastEnd := 0, -1, 0
+	var head uint64
+	var firstStep uint32
+
+	// 循环可能比环形缓冲区长，入口和起始步在开始时记下
+	finish := func(end int) {
+		if n := (end - start) / period; n >= minLoopIterations {
+			loops = append(loops, &Loop{
+				Head:       head,
+				Period:     period,
+				Start:      start,
+				End:        end,
+				Iterations: n,
+				FirstStep:  firstStep,
+				LastStep:   steps[(end-1)%len(ring)],
+			})
+			lastEnd = end
+		}
+		period = 0
+	}
+
+	total := 0
+	err := tm.Scan(func(index int, t *TraceLine) bool {
+		if period > 0 && t.Addr != ring[(index-period)%len(ring)] {
+			finish(index)
+		}
+		if period == 0 {
+			if j, ok := lastSeen[t.Addr]; ok && j >= lastEnd && index-j <= maxLoopPeriod {
+				period, start = index-j, j
+				head, firstStep = t.Addr, steps[j%len(ring)]
+			}
+		}
+		ring[index%len(ring)] = t.Addr
+		steps[index%len(ring)] = t.Step
+		lastSeen[t.Addr] = index
+		total = index + 1
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if period > 0 {
+		finish(total)
+	}
+	return loops, nil
+}
+
+// FindLoop 返回包含第 index 行的循环，没有时返回 nil
+func FindLoop(loops []*Loop, index int) *Loop {
+	i := sort.Search(len(loops), func(i int) bool { return loops[i].End > index })
+	if i < len(loops) && loops[i].Contains(index) {
+		return loops[i]
+	}
+	return nil
+}
+
+// FormatLoops 列出所有循环，current 所在的循环用 ▶ 标出
+func FormatLoops(loops []*Loop, current int, folded map[int]bool) string {
+	var sb strings.Builder
+	for _, l := range loops {
+		marker := "  "
+		if l.Contains(current) {
+			marker = "▶ "
+		}
+		state := ""
+		if folded[l.Start] {
+			state = " [folded]"
+		}
+		sb.WriteString(fmt.Sprintf("%s%5d-%-5d %s, %d instrs/iter%s\n", marker, l.Start, l.End-1, l, l.Period, state))
+	}
+	return sb.String()
+}
+
+// Loops 返回（必要时检测）trace 中的循环
+func (tm *TraceManager) Loops() ([]*Loop, error) {
+	if tm.loops != nil {
+		return tm.loops, nil
+	}
+	loops, err := DetectLoops(tm)
+	if err != nil {
+		return nil, err
+	}
+	if loops == nil {
+		loops = []*Loop{}
+	}
+	tm.loops = loops
+	return loops, nil
+}
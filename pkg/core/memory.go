@@ -0,0 +1,266 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseHexdumpLine 解析一行十六进制转储，例如：
+// "7fda1a4228: 40 00 00 00 00 00 00 00 20 44 1a da 7f 00 00 00  |@....... D......|"
+// 行首没有地址时 hasAddr 为 false，由调用者按上下文推算地址
+func ParseHexdumpLine(line string) (addr uint64, data []byte, hasAddr bool, ok bool) {
+	// 去掉右侧的 ASCII 部分
+	if idx := strings.Index(line, "|"); idx != -1 {
+		line = line[:idx]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return 0, nil, false, false
+	}
+
+	if strings.HasSuffix(fields[0], ":") {
+		a, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSuffix(fields[0], ":"), "0x"), 16, 64)
+		if err != nil {
+			return 0, nil, false, false
+		}
+		addr, hasAddr = a, true
+		fields = fields[1:]
+	}
+
+	for _, f := range fields {
+		if len(f) != 2 {
+			break
+		}
+		b, err := strconv.ParseUint(f, 16, 8)
+		if err != nil {
+			break
+		}
+		data = append(data, byte(b))
+	}
+	return addr, data, hasAddr, len(data) > 0
+}
+
+// memVersion 是某个字节在某一步之后的值
+type memVersion struct {
+	Step  int32
+	Value byte
+}
+
+// ShadowMemory 根据 RW/BL 日志中的十六进制转储重建的稀疏、带版本的内存模型
+// 日志只给出零散的快照，因此只能回答"在这一步时已知的内容"，从未出现过的字节是未知的
+type ShadowMemory struct {
+	bytes map[uint64][]memVersion // 每个地址按 Step 递增的取值历史，只记录变化
+}
+
+// memorySnapshot 是一条日志中的转储
+type memorySnapshot struct {
+	step  int
+	base  uint64 // 转储行没有地址时使用
+	lines []string
+}
+
+// BuildShadowMemory 把日志中的所有转储按步数顺序叠加到内存模型上
+func BuildShadowMemory(lm *LogManager) *ShadowMemory {
+	var snaps []memorySnapshot
+	for step, logs := range lm.RwLogs {
+		for _, log := range logs {
+			snaps = append(snaps, memorySnapshot{step: step, base: log.EffectiveAddress(), lines: log.MemoryHex})
+		}
+	}
+	for step, logs := range lm.BlLogs {
+		for _, log := range logs {
+			base, _ := strconv.ParseUint(log.Address, 0, 64)
+			snaps = append(snaps, memorySnapshot{step: step, base: base, lines: log.MemoryHex})
+		}
+	}
+	sort.SliceStable(snaps, func(i, j int) bool { return snaps[i].step < snaps[j].step })
+
+	m := &ShadowMemory{bytes: make(map[uint64][]memVersion)}
+	for _, snap := range snaps {
+		next := snap.base
+		for _, line := range snap.lines {
+			addr, data, hasAddr, ok := ParseHexdumpLine(line)
+			if !ok {
+				continue
+			}
+			if !hasAddr {
+				addr = next
+			}
+			for i, b := range data {
+				m.set(addr+uint64(i), snap.step, b)
+			}
+			next = addr + uint64(len(data))
+		}
+	}
+	return m
+}
+
+func (m *ShadowMemory) set(addr uint64, step int, value byte) {
+	versions := m.bytes[addr]
+	if n := len(versions); n > 0 {
+		last := &versions[n-1]
+		if last.Value == value {
+			return
+		}
+		if int(last.Step) == step {
+			last.Value = value
+			return
+		}
+	}
+	m.bytes[addr] = append(versions, memVersion{Step: int32(step), Value: value})
+}
+
+// version 返回 addr 在 step 时生效的版本下标，-1 表示当时未知
+func (m *ShadowMemory) version(addr uint64, step int) ([]memVersion, int) {
+	versions := m.bytes[addr]
+	i := sort.Search(len(versions), func(i int) bool { return int(versions[i].Step) > step }) - 1
+	return versions, i
+}
+
+// ByteAt 返回 step 时 addr 处已知的字节
+func (m *ShadowMemory) ByteAt(addr uint64, step int) (byte, bool) {
+	versions, i := m.version(addr, step)
+	if i < 0 {
+		return 0, false
+	}
+	return versions[i].Value, true
+}
+
+// Read 读取 [addr, addr+n) 在 step 时的内容，known[i] 表示第 i 个字节是否已知
+func (m *ShadowMemory) Read(addr uint64, n int, step int) (data []byte, known []bool) {
+	data = make([]byte, n)
+	known = make([]bool, n)
+	for i := 0; i < n; i++ {
+		data[i], known[i] = m.ByteAt(addr+uint64(i), step)
+	}
+	return data, known
+}
+
+// ChangedAt 报告 addr 处已知的字节是否恰好在 step 这一步变成了新值
+// 第一次出现在转储里的字节不算变化
+func (m *ShadowMemory) ChangedAt(addr uint64, step int) bool {
+	versions, i := m.version(addr, step)
+	return i > 0 && int(versions[i].Step) == step
+}
+
+// Empty 报告模型中是否没有任何已知字节
+func (m *ShadowMemory) Empty() bool {
+	return len(m.bytes) == 0
+}
+
+// KnownRanges 返回所有曾经出现过的地址，合并为连续区间
+func (m *ShadowMemory) KnownRanges() []ValueRange {
+	addrs := make([]uint64, 0, len(m.bytes))
+	for addr := range m.bytes {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+
+	var ranges []ValueRange
+	for _, addr := range addrs {
+		if n := len(ranges); n > 0 && ranges[n-1].High+1 == addr {
+			ranges[n-1].High = addr
+			continue
+		}
+		ranges = append(ranges, ValueRange{Low: addr, High: addr})
+	}
+	return ranges
+}
+
+// MemoryDiffRow 是两步之间至少有一个字节不同的 16 字节行
+type MemoryDiffRow struct {
+	Addr    uint64
+	A, B    [16]byte
+	KnownA  [16]bool
+	KnownB  [16]bool
+	Diff    [16]bool
+	InScope [16]bool // 是否在比较范围内
+}
+
+// Diff 比较 stepA 与 stepB 时 scope 内的已知内容，按 16 字节对齐返回有差异的行
+// 一侧已知一侧未知也算差异；scope 为空时比较所有出现过的地址
+func (m *ShadowMemory) Diff(stepA, stepB int, scope []ValueRange) []*MemoryDiffRow {
+	// 只遍历 scope 与已知区间的交集，避免在巨大的空区间上逐字节比较
+	known := m.KnownRanges()
+	ranges := known
+	if len(scope) > 0 {
+		ranges = nil
+		for _, s := range scope {
+			for _, k := range known {
+				lo, hi := max(s.Low, k.Low), min(s.High, k.High)
+				if lo <= hi {
+					ranges = append(ranges, ValueRange{Low: lo, High: hi})
+				}
+			}
+		}
+	}
+
+	var rows []*MemoryDiffRow
+	for _, r := range ranges {
+		for base := r.Low &^ 0xf; base <= r.High; base += 16 {
+			row := &MemoryDiffRow{Addr: base}
+			changed := false
+			for i := uint64(0); i < 16; i++ {
+				addr := base + i
+				if addr < r.Low || addr > r.High {
+					continue
+				}
+				row.InScope[i] = true
+				row.A[i], row.KnownA[i] = m.ByteAt(addr, stepA)
+				row.B[i], row.KnownB[i] = m.ByteAt(addr, stepB)
+				if row.KnownA[i] != row.KnownB[i] || row.A[i] != row.B[i] {
+					row.Diff[i] = true
+					changed = true
+				}
+			}
+			if changed {
+				rows = append(rows, row)
+			}
+			if base+16 < base {
+				break
+			}
+		}
+	}
+	return rows
+}
+
+// maxDumpSize 限制单次导出的大小，防止写错地址时生成巨大的文件
+const maxDumpSize = 256 << 20
+
+// DumpMaskSuffix 是未知字节掩码文件的后缀
+const DumpMaskSuffix = ".mask"
+
+// Dump 把 [start, end) 在 step 时的内容写入 path，未知字节写 0
+// 同时写出 path+".mask"：与数据等长，未知字节处为 0xff，已知为 0x00
+// 返回已知字节数
+func (m *ShadowMemory) Dump(path string, start, end uint64, step int) (int, error) {
+	if end <= start {
+		return 0, fmt.Errorf("empty range 0x%x-0x%x", start, end)
+	}
+	if end-start > maxDumpSize {
+		return 0, fmt.Errorf("range too large: 0x%x bytes", end-start)
+	}
+
+	data, known := m.Read(start, int(end-start), step)
+	mask := make([]byte, len(data))
+	count := 0
+	for i, k := range known {
+		if k {
+			count++
+		} else {
+			mask[i] = 0xff
+		}
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(path+DumpMaskSuffix, mask, 0644); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -17,6 +18,11 @@ type TraceLine struct {
 	Regs   [31]uint64 // x0-x30
 	SP     uint64
 	PC     uint64
+
+	Opcode    uint32 // 机器码，HasOpcode 为 false 时无效
+	HasOpcode bool
+
+	decoded *DecodedInstr // Decode 的缓存
 }
 
 // TraceManager 管理指令跟踪
@@ -31,6 +37,13 @@ type TraceManager struct {
 	windowSize int    // 新增：窗口大小
 	isLoading  bool   // 新增：防止重复加载
 	LogManager *LogManager
+	ErrorLog   io.Writer // 加载窗口时的解析错误写到这里，nil 时不输出
+
+	callStack *CallStack // 影子调用栈，首次使用时构建
+	regionMap *RegionMap // 推断出的内存区域，首次使用时构建
+	cfg       *CFG       // 动态控制流图，首次使用时构建
+	loops     []*Loop    // 检测到的循环，首次使用时构建
+	vm        *VM        // 以最常执行的间接跳转为分发器的虚拟机结构，首次使用时构建
 }
 
 func NewTraceManager() *TraceManager {
@@ -42,6 +55,7 @@ func NewTraceManager() *TraceManager {
 		windowSize:   2000, // 默认窗口大小
 		isLoading:    false,
 		LogManager:   NewLogManager(), // 初始化日志管理器
+		ErrorLog:     os.Stderr,       // 不和导出到标准输出的结果混在一起
 	}
 }
 
@@ -95,7 +109,9 @@ func (tm *TraceManager) loadFileWindow(start, end int) error {
 			line := scanner.Text()
 			traceLine, err := ParseLine(line)
 			if err != nil {
-				fmt.Printf("解析错误 第%d行: %v\n", currentLine+1, err)
+				if tm.ErrorLog != nil {
+					fmt.Fprintf(tm.ErrorLog, "解析错误 第%d行: %v\n", currentLine+1, err)
+				}
 				// 即使解析错误，也添加一个占位符
 				tm.Instructions = append(tm.Instructions, nil)
 			} else {
@@ -154,19 +170,96 @@ func (tm *TraceManager) GetLine(index int) *TraceLine {
 	return nil
 }
 
+// LineAt 返回第 index 行，不在已加载的窗口内时同步加载以它为中心的窗口
+func (tm *TraceManager) LineAt(index int) *TraceLine {
+	if index < 0 || index >= tm.totalLines {
+		return nil
+	}
+	if index < tm.LoadedRange[0] || index >= tm.LoadedRange[1] {
+		if err := tm.LoadWindow(index); err != nil {
+			return nil
+		}
+	}
+	return tm.GetLine(index)
+}
+
 func (tm *TraceManager) Total() int {
 	return tm.totalLines
 }
 
+// Scan 从头到尾流式遍历整个 trace，不受加载窗口限制
+// 解析失败的行会被跳过但仍占用索引，fn 返回 false 时提前结束
+func (tm *TraceManager) Scan(fn func(index int, t *TraceLine) bool) error {
+	if tm.FileName == "" {
+		for i, t := range tm.Instructions {
+			if t != nil && !fn(i, t) {
+				break
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(tm.FileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	index := 0
+	for scanner.Scan() {
+		if t, err := ParseLine(scanner.Text()); err == nil {
+			if !fn(index, t) {
+				return nil
+			}
+		}
+		index++
+	}
+	return scanner.Err()
+}
+
+// resetAnalysis 丢弃基于整个 trace 计算出的缓存结果
+func (tm *TraceManager) resetAnalysis() {
+	tm.callStack = nil
+	tm.regionMap = nil
+	tm.cfg = nil
+	tm.loops = nil
+	tm.vm = nil
+}
+
+// Mnemonic 返回指令助记符（小写）
+func (t *TraceLine) Mnemonic() string {
+	return t.Decode().Mnemonic
+}
+
 // ParseLine 解析日志中的一行
+// 支持三种格式：
+//   - step|addr|offset|"instr"|x0...x28|x29|x30|sp|pc
+//   - step|addr|offset|opcode|x0...（只有机器码，没有指令文本）
+//   - step|addr|offset|opcode|"instr"|x0...（指令文本为空时由机器码反汇编）
 func ParseLine(line string) (*TraceLine, error) {
 	fields := strings.Split(line, "|")
-	if len(fields) != 37 {
+	t := &TraceLine{}
+
+	switch len(fields) {
+	case 37:
+		if opcode, ok := parseOpcode(fields[3]); ok {
+			t.Opcode, t.HasOpcode = opcode, true
+			fields[3] = ""
+		} else if looksLikeOpcode(fields[3]) {
+			return nil, fmt.Errorf("解析 opcode 失败: %q", fields[3])
+		}
+	case 38:
+		opcode, ok := parseOpcode(fields[3])
+		if !ok {
+			return nil, fmt.Errorf("解析 opcode 失败: %q", fields[3])
+		}
+		t.Opcode, t.HasOpcode = opcode, true
+		fields = append(fields[:3], fields[4:]...)
+	default:
 		return nil, fmt.Errorf("字段数量不对: %d", len(fields))
 	}
 
-	t := &TraceLine{}
-
 	// step
 	step, err := strconv.ParseUint(strings.TrimSpace(fields[0]), 16, 32)
 	if err != nil {
@@ -193,6 +286,9 @@ func ParseLine(line string) (*TraceLine, error) {
 	if strings.HasPrefix(t.Instr, "\"") && strings.HasSuffix(t.Instr, "\"") {
 		t.Instr = t.Instr[1 : len(t.Instr)-1]
 	}
+	if t.Instr == "" && t.HasOpcode {
+		t.Instr = Disassemble(t.Opcode, t.Addr)
+	}
 
 	// x0-x28
 	for i := 0; i <= 28; i++ {
@@ -253,6 +349,7 @@ func ReadTraceFile(filename string, tm *TraceManager) error {
 
 	// 保存文件名
 	tm.FileName = filename
+	tm.resetAnalysis()
 
 	// 加载初始窗口（以第0行为中心）
 	return tm.LoadWindow(0)
@@ -323,4 +420,5 @@ func (tm *TraceManager) GoTo(index int) bool {
 func (tm *TraceManager) AddInstruction(t *TraceLine) {
 	tm.Instructions = append(tm.Instructions, t)
 	tm.totalLines = len(tm.Instructions)
+	tm.resetAnalysis()
 }
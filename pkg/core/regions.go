@@ -0,0 +1,269 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RegionKind 是推断出的内存区域类型
+type RegionKind int
+
+const (
+	RegionUnknown RegionKind = iota
+	RegionCode
+	RegionStack
+	RegionHeap
+	RegionData
+)
+
+func (k RegionKind) String() string {
+	switch k {
+	case RegionCode:
+		return "code"
+	case RegionStack:
+		return "stack"
+	case RegionHeap:
+		return "heap"
+	case RegionData:
+		return "data"
+	}
+	return "unknown"
+}
+
+// Color 返回与 pwndbg 类似的区域配色
+func (k RegionKind) Color() string {
+	switch k {
+	case RegionCode:
+		return "red"
+	case RegionStack:
+		return "fuchsia"
+	case RegionHeap:
+		return "dodgerblue"
+	case RegionData:
+		return "mediumpurple"
+	}
+	return ""
+}
+
+// Region 是一段推断出的内存区域 [Start, End)
+type Region struct {
+	Start  uint64
+	End    uint64
+	Kind   RegionKind
+	Module uint64 // 代码区所属模块基址（Addr - Offset），未知为 0
+	Source string // 推断依据
+}
+
+// RegionMap 是根据 trace 推断出的 vmmap
+type RegionMap struct {
+	Regions []*Region // 按 Start 递增
+}
+
+const (
+	pageSize     = 0x1000
+	clusterGap   = 0x10000   // 相距不超过这么远的访问地址归为同一区域
+	moduleWindow = 0x1000000 // 模块基址之后这么远内的非栈地址视为模块数据
+)
+
+func pageDown(addr uint64) uint64 { return addr &^ (pageSize - 1) }
+func pageUp(addr uint64) uint64   { return (addr + pageSize - 1) &^ (pageSize - 1) }
+
+// BuildRegionMap 由 SP 范围推断栈，由 PC 按模块推断代码段，cs 中的调用目标和 BL 目标补充外部代码，
+// 读写地址按聚类归为模块数据或堆；cs 可以为 nil
+func BuildRegionMap(tm *TraceManager, cs *CallStack) (*RegionMap, error) {
+	type span struct{ lo, hi uint64 }
+	modules := make(map[uint64]*span)
+	var stack *span
+
+	err := tm.Scan(func(index int, t *TraceLine) bool {
+		base := t.Addr - t.Offset
+		if m := modules[base]; m == nil {
+			modules[base] = &span{t.Addr, t.Addr}
+		} else {
+			m.lo, m.hi = min(m.lo, t.Addr), max(m.hi, t.Addr)
+		}
+		if t.SP != 0 {
+			if stack == nil {
+				stack = &span{t.SP, t.SP}
+			} else {
+				stack.lo, stack.hi = min(stack.lo, t.SP), max(stack.hi, t.SP)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 不同基址的代码段扩展到页边界后可能重叠，按地址顺序插入，后插入的让出重叠部分
+	var code []*Region
+	for base, m := range modules {
+		code = append(code, &Region{
+			Start:  pageDown(m.lo),
+			End:    pageUp(m.hi + 4),
+			Kind:   RegionCode,
+			Module: base,
+			Source: "executed PCs",
+		})
+	}
+	sort.Slice(code, func(i, j int) bool { return code[i].Start < code[j].Start })
+	rm := &RegionMap{}
+	for _, r := range code {
+		rm.insert(r)
+	}
+	if stack != nil {
+		// SP 之上还有调用者的栈帧，向上多留一页
+		rm.insert(&Region{
+			Start:  pageDown(stack.lo),
+			End:    pageUp(stack.hi) + pageSize,
+			Kind:   RegionStack,
+			Source: "SP range",
+		})
+	}
+
+	// 调用目标中不属于已知模块的，作为外部代码
+	var targets []uint64
+	if cs != nil {
+		for _, f := range cs.Frames() {
+			targets = append(targets, f.Target)
+		}
+	}
+	for _, logs := range tm.LogManager.BlLogs {
+		for _, log := range logs {
+			if addr, err := strconv.ParseUint(strings.TrimSpace(log.Address), 0, 64); err == nil {
+				targets = append(targets, addr)
+			}
+		}
+	}
+	rm.addClusters(targets, func(lo, hi uint64) *Region {
+		return &Region{Start: pageDown(lo), End: pageUp(hi + 4), Kind: RegionCode, Source: "call targets"}
+	})
+
+	// 读写地址：靠近某个模块的视为模块数据，其余视为堆
+	var accesses []uint64
+	for _, logs := range tm.LogManager.RwLogs {
+		for _, log := range logs {
+			accesses = append(accesses, log.EffectiveAddress())
+		}
+	}
+	rm.addClusters(accesses, func(lo, hi uint64) *Region {
+		r := &Region{Start: pageDown(lo), End: pageUp(hi + 1), Kind: RegionHeap, Source: "RW accesses"}
+		if stack != nil && hi+clusterGap >= stack.lo && lo <= stack.hi+clusterGap {
+			r.Kind = RegionStack
+			return r
+		}
+		for base := range modules {
+			if lo >= base && lo-base < moduleWindow {
+				r.Kind = RegionData
+				r.Module = base
+				break
+			}
+		}
+		return r
+	})
+	return rm, nil
+}
+
+// addClusters 把尚未被覆盖的地址按 clusterGap 聚类，每个聚类用 newRegion 生成一个区域
+func (rm *RegionMap) addClusters(addrs []uint64, newRegion func(lo, hi uint64) *Region) {
+	var free []uint64
+	for _, addr := range addrs {
+		if addr != 0 && rm.Find(addr) == nil {
+			free = append(free, addr)
+		}
+	}
+	sort.Slice(free, func(i, j int) bool { return free[i] < free[j] })
+
+	var added []*Region
+	for i := 0; i < len(free); {
+		j := i
+		for j+1 < len(free) && free[j+1]-free[j] <= clusterGap {
+			j++
+		}
+		added = append(added, newRegion(free[i], free[j]))
+		i = j + 1
+	}
+	for _, r := range added {
+		rm.insert(r)
+	}
+}
+
+// insert 加入区域 r，r 与已有区域重叠的部分被裁掉，完全包住某个已有区域时拆成前后两段
+// Find 依赖区域互不重叠且按 Start 排序
+func (rm *RegionMap) insert(r *Region) {
+	pieces := []*Region{r}
+	for _, other := range rm.Regions {
+		var next []*Region
+		for _, p := range pieces {
+			if p.End <= other.Start || other.End <= p.Start {
+				next = append(next, p)
+				continue
+			}
+			if p.Start < other.Start {
+				left := *p
+				left.End = other.Start
+				next = append(next, &left)
+			}
+			if other.End < p.End {
+				right := *p
+				right.Start = other.End
+				next = append(next, &right)
+			}
+		}
+		pieces = next
+	}
+	rm.Regions = append(rm.Regions, pieces...)
+	rm.sort()
+}
+
+func (rm *RegionMap) sort() {
+	sort.Slice(rm.Regions, func(i, j int) bool { return rm.Regions[i].Start < rm.Regions[j].Start })
+}
+
+// Find 返回包含 addr 的区域
+func (rm *RegionMap) Find(addr uint64) *Region {
+	i := sort.Search(len(rm.Regions), func(i int) bool { return rm.Regions[i].End > addr })
+	if i < len(rm.Regions) && rm.Regions[i].Start <= addr {
+		return rm.Regions[i]
+	}
+	return nil
+}
+
+// Format 以 vmmap 的形式列出所有区域
+func (rm *RegionMap) Format() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%-18s %-18s %-10s %-6s %s\n", "Start", "End", "Size", "Kind", "Module / Source"))
+	for _, r := range rm.Regions {
+		module := r.Source
+		if r.Module != 0 {
+			module = fmt.Sprintf("base 0x%x (%s)", r.Module, r.Source)
+		}
+		sb.WriteString(fmt.Sprintf("[%s]0x%016x 0x%016x 0x%-8x %-6s[-] %s\n",
+			r.Kind.Color(), r.Start, r.End, r.End-r.Start, r.Kind, module))
+	}
+	return sb.String()
+}
+
+// RegionMap 返回（必要时构建）推断出的内存区域
+func (tm *TraceManager) RegionMap() (*RegionMap, error) {
+	if tm.regionMap != nil {
+		return tm.regionMap, nil
+	}
+	cs, err := tm.CallStack()
+	if err != nil {
+		return nil, err
+	}
+	rm, err := BuildRegionMap(tm, cs)
+	if err != nil {
+		return nil, err
+	}
+	tm.regionMap = rm
+	return rm, nil
+}
+
+// BuiltRegionMap 返回已经构建好的区域表，还没有构建时返回 nil，不触发扫描
+func (tm *TraceManager) BuiltRegionMap() *RegionMap {
+	return tm.regionMap
+}
@@ -0,0 +1,61 @@
+package core
+
+import "testing"
+
+func TestRegionMapInsert(t *testing.T) {
+	rm := &RegionMap{}
+	rm.insert(&Region{Start: 0x3000, End: 0x4000, Kind: RegionCode})
+	// 完全包住已有区域，拆成前后两段
+	rm.insert(&Region{Start: 0x1000, End: 0x6000, Kind: RegionHeap})
+	// 与已有区域部分重叠
+	rm.insert(&Region{Start: 0x5000, End: 0x8000, Kind: RegionData})
+
+	want := []Region{
+		{Start: 0x1000, End: 0x3000, Kind: RegionHeap},
+		{Start: 0x3000, End: 0x4000, Kind: RegionCode},
+		{Start: 0x4000, End: 0x6000, Kind: RegionHeap},
+		{Start: 0x6000, End: 0x8000, Kind: RegionData},
+	}
+	if len(rm.Regions) != len(want) {
+		t.Fatalf("got %d regions, want %d", len(rm.Regions), len(want))
+	}
+	for i, w := range want {
+		if *rm.Regions[i] != w {
+			t.Errorf("region %d: got %+v, want %+v", i, *rm.Regions[i], w)
+		}
+	}
+
+	for addr, kind := range map[uint64]RegionKind{0x1000: RegionHeap, 0x3fff: RegionCode, 0x5000: RegionHeap, 0x7fff: RegionData} {
+		if r := rm.Find(addr); r == nil || r.Kind != kind {
+			t.Errorf("Find(0x%x) = %+v, want %s", addr, r, kind)
+		}
+	}
+	if r := rm.Find(0x8000); r != nil {
+		t.Errorf("Find(0x8000) = %+v, want nil", r)
+	}
+}
+
+// 两个基址不同的模块代码段扩展到页边界后重叠，Find 仍然要能找到每个执行过的地址
+func TestBuildRegionMapOverlappingModules(t *testing.T) {
+	tm := NewTraceManager()
+	for i, pc := range []struct{ addr, offset uint64 }{
+		{0x10000, 0x0}, {0x10800, 0x800}, {0x10400, 0x10400}, {0x13000, 0x13000},
+	} {
+		tm.AddInstruction(&TraceLine{Step: uint32(i), Addr: pc.addr, Offset: pc.offset, Instr: "nop", SP: 0x7fff0000})
+	}
+
+	rm, err := BuildRegionMap(tm, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range rm.Regions {
+		if i > 0 && rm.Regions[i-1].End > r.Start {
+			t.Errorf("regions overlap: %+v and %+v", *rm.Regions[i-1], *r)
+		}
+	}
+	for _, addr := range []uint64{0x10000, 0x10400, 0x10800, 0x13000, 0x7fff0000} {
+		if rm.Find(addr) == nil {
+			t.Errorf("Find(0x%x) = nil", addr)
+		}
+	}
+}
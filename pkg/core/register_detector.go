@@ -1,10 +1,16 @@
 package core
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 type RegisterChangeDetector struct {
-	lastValues [33]uint64 // 31个通用寄存器 + SP + PC
-	hasPrev    bool
+	lastValues  [33]uint64 // 31个通用寄存器 + SP + PC
+	hasPrev     bool
+	lastStep    uint32       // 上次比较的指令
+	lastChanges map[int]bool // 上次比较的结果，同一条指令重新绘制时沿用
 }
 
 func NewRegisterChangeDetector() *RegisterChangeDetector {
@@ -12,6 +18,9 @@ func NewRegisterChangeDetector() *RegisterChangeDetector {
 }
 
 func (r *RegisterChangeDetector) Update(current *TraceLine) map[int]bool {
+	if current != nil && r.hasPrev && current.Step == r.lastStep {
+		return r.lastChanges
+	}
 	changes := make(map[int]bool)
 
 	if r.hasPrev {
@@ -39,6 +48,8 @@ func (r *RegisterChangeDetector) Update(current *TraceLine) map[int]bool {
 		r.lastValues[31] = current.SP
 		r.lastValues[32] = current.PC
 		r.hasPrev = true
+		r.lastStep = current.Step
+		r.lastChanges = changes
 	}
 
 	return changes
@@ -55,3 +66,40 @@ func (r *RegisterChangeDetector) GetRegisterName(index int) string {
 	}
 	return ""
 }
+
+// RegisterIndex 把寄存器名解析为索引（x0-x30 为 0-30，SP 为 31，PC 为 32）
+// 支持 w 寄存器、fp/lr 别名以及 gdb 风格的 $ 前缀，无法识别时返回 -1
+func RegisterIndex(name string) int {
+	name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "$"))
+	switch name {
+	case "sp", "wsp":
+		return 31
+	case "pc":
+		return 32
+	case "fp":
+		return 29
+	case "lr":
+		return 30
+	}
+	if len(name) < 2 || (name[0] != 'x' && name[0] != 'w') {
+		return -1
+	}
+	n, err := strconv.Atoi(name[1:])
+	if err != nil || n < 0 || n > 30 {
+		return -1
+	}
+	return n
+}
+
+// RegisterValue 按 RegisterIndex 的编号读取寄存器值
+func (t *TraceLine) RegisterValue(index int) uint64 {
+	switch {
+	case index >= 0 && index < 31:
+		return t.Regs[index]
+	case index == 31:
+		return t.SP
+	case index == 32:
+		return t.PC
+	}
+	return 0
+}
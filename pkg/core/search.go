@@ -0,0 +1,80 @@
+package core
+
+import (
+	"regexp"
+	"sort"
+)
+
+// LineRef 指向 trace 中的某一行，只保留列表展示需要的字段
+type LineRef struct {
+	Index int
+	Step  uint32
+	Addr  uint64
+	Instr string
+}
+
+// NewLineRef 为第 index 行创建引用
+func NewLineRef(index int, t *TraceLine) LineRef {
+	return LineRef{Index: index, Step: t.Step, Addr: t.Addr, Instr: t.Instr}
+}
+
+// CompilePattern 把搜索串编译为正则，不是合法正则时按普通文本处理
+func CompilePattern(pattern string) *regexp.Regexp {
+	if re, err := regexp.Compile(pattern); err == nil {
+		return re
+	}
+	return regexp.MustCompile(regexp.QuoteMeta(pattern))
+}
+
+// SearchInstructions 在整个 trace 的指令文本中搜索，而不只是当前加载的窗口
+func (tm *TraceManager) SearchInstructions(pattern string) ([]LineRef, error) {
+	re := CompilePattern(pattern)
+
+	var matches []LineRef
+	err := tm.Scan(func(index int, t *TraceLine) bool {
+		if re.MatchString(t.Instr) {
+			matches = append(matches, NewLineRef(index, t))
+		}
+		return true
+	})
+	return matches, err
+}
+
+// nextMatch 返回 from 之后（backward 时为之前）的第一个匹配，到头后回绕
+func nextMatch(matches []LineRef, from int, backward bool) (int, bool) {
+	if len(matches) == 0 {
+		return -1, false
+	}
+
+	if backward {
+		i := sort.Search(len(matches), func(i int) bool { return matches[i].Index >= from }) - 1
+		if i < 0 {
+			return len(matches) - 1, true
+		}
+		return i, false
+	}
+
+	i := sort.Search(len(matches), func(i int) bool { return matches[i].Index > from })
+	if i >= len(matches) {
+		return 0, true
+	}
+	return i, false
+}
+
+// LinesForSteps 查找 step 值在 steps 中的行，全部找到后提前结束扫描
+func (tm *TraceManager) LinesForSteps(steps map[int]bool) (map[int]LineRef, error) {
+	found := make(map[int]LineRef, len(steps))
+	if len(steps) == 0 {
+		return found, nil
+	}
+	err := tm.Scan(func(index int, t *TraceLine) bool {
+		step := int(t.Step)
+		if steps[step] {
+			if _, ok := found[step]; !ok {
+				found[step] = NewLineRef(index, t)
+			}
+		}
+		return len(found) < len(steps)
+	})
+	return found, err
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Session 是可以交给他人复现现场的完整会话
+// 断点与 watch 目前尚未实现，界面布局是固定的，因此都没有对应字段
+type Session struct {
+	Version       int           `json:"version"`
+	TraceFile     string        `json:"trace_file"` // 相对于会话文件所在目录（无法相对时为绝对路径）
+	TraceHash     string        `json:"trace_hash"`
+	CurrentIndex  int           `json:"current_index"`
+	StepDelay     int           `json:"step_delay"`
+	Bookmarks     []*Bookmark   `json:"bookmarks,omitempty"`
+	History       []string      `json:"history,omitempty"`
+	SearchPattern string        `json:"search_pattern,omitempty"`
+	Panel         *SessionPanel `json:"panel,omitempty"`
+}
+
+// SessionPanel 记录结果面板当时显示的内容
+type SessionPanel struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+const sessionVersion = 1
+
+// SaveSession 把当前会话写入 path
+func (u *User) SaveSession(path string) error {
+	tm := u.TraceManager
+	if tm.FileName == "" {
+		return fmt.Errorf("no trace file loaded")
+	}
+
+	hash := u.Bookmarks.Hash
+	if hash == "" {
+		var err error
+		if hash, err = TraceHash(tm.FileName); err != nil {
+			return err
+		}
+	}
+
+	traceFile, err := filepath.Abs(tm.FileName)
+	if err != nil {
+		return err
+	}
+	if dir, err := filepath.Abs(filepath.Dir(path)); err == nil {
+		if rel, err := filepath.Rel(dir, traceFile); err == nil {
+			traceFile = rel
+		}
+	}
+
+	s := &Session{
+		Version:       sessionVersion,
+		TraceFile:     traceFile,
+		TraceHash:     hash,
+		CurrentIndex:  tm.CurrentIndex,
+		StepDelay:     u.StepDelay,
+		Bookmarks:     u.Bookmarks.Marks,
+		History:       u.History,
+		SearchPattern: u.searchPattern,
+	}
+	if u.ResultTitle != "" {
+		s.Panel = &SessionPanel{Title: u.ResultTitle, Text: u.ResultText}
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadSession 读取会话文件，并把 TraceFile 解析为可直接打开的路径
+func LoadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("invalid session file: %v", err)
+	}
+	if s.Version > sessionVersion {
+		return nil, fmt.Errorf("unsupported session version %d", s.Version)
+	}
+	if s.TraceFile == "" {
+		return nil, fmt.Errorf("session has no trace file")
+	}
+	if !filepath.IsAbs(s.TraceFile) {
+		s.TraceFile = filepath.Join(filepath.Dir(path), s.TraceFile)
+	}
+	return s, nil
+}
+
+// ApplySession 在 trace 加载完成后恢复会话状态
+// trace 内容与保存时不一致时仍会恢复，但返回错误提醒行号可能已经对不上
+func (u *User) ApplySession(s *Session) error {
+	if s.StepDelay > 0 {
+		u.StepDelay = s.StepDelay
+	}
+	u.History = append([]string(nil), s.History...)
+	u.searchPattern = s.SearchPattern
+
+	// 会话中的书签合并进当前书签，不主动写回 sidecar
+	for _, m := range s.Bookmarks {
+		b := u.Bookmarks.Set(m.Name, LineRef{Index: m.Index, Step: m.Step, Addr: m.Addr})
+		b.Note = m.Note
+	}
+
+	if s.Panel != nil {
+		u.showResult(s.Panel.Title, s.Panel.Text)
+	}
+
+	tm := u.TraceManager
+	if err := tm.LoadWindow(s.CurrentIndex); err != nil {
+		return err
+	}
+	if !tm.GoTo(s.CurrentIndex) {
+		return fmt.Errorf("invalid line number in session: %d", s.CurrentIndex)
+	}
+
+	if s.TraceHash != "" && u.Bookmarks.Hash != "" && s.TraceHash != u.Bookmarks.Hash {
+		return fmt.Errorf("trace file has changed since the session was saved")
+	}
+	return nil
+}
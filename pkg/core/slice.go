@@ -0,0 +1,109 @@
+package core
+
+import (
+	"sort"
+)
+
+// Slice 是从某一行某个寄存器出发的后向数据流切片：
+// 所有对该寄存器在这一行执行前的值有贡献的指令
+type Slice struct {
+	Target     string
+	Index      int       // 起点行，切片只包含它之前的指令
+	Lines      []LineRef // 按行号升序
+	Unresolved uint64    // 追溯到 trace 开头仍没有找到定义的寄存器
+	memory     int       // 同上，未找到写入的内存字节数
+}
+
+// BackwardSlice 沿寄存器和 RW 日志中的内存做 def-use 回溯
+// 访存地址用到的寄存器也算作来源，这样能追到表查询的下标和虚拟机的字节码指针
+func (tm *TraceManager) BackwardSlice(index int, reg int, target string) (*Slice, error) {
+	// 先正向收集每一行的数据流（trace 只能顺序读取），只保留数据流和行号，
+	// 指令文本等切片确定后再取。第 k 条记录的数据流为 flows[starts[k]:starts[k+1]]
+	var flows []flow
+	var starts, indices []int
+	err := tm.Scan(func(i int, t *TraceLine) bool {
+		if i >= index {
+			return false
+		}
+		f, _ := dataflow(t, tm.LogManager)
+		starts = append(starts, len(flows))
+		indices = append(indices, i)
+		flows = append(flows, f...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	starts = append(starts, len(flows))
+
+	regs := uint64(1) << uint(reg)
+	memory := make(map[uint64]bool)
+	s := &Slice{Target: target, Index: index}
+
+	wanted := make(map[int]bool)
+	for k := len(indices) - 1; k >= 0 && (regs != 0 || len(memory) > 0); k-- {
+		var matched []flow
+		for _, f := range flows[starts[k]:starts[k+1]] {
+			if f.dstReg >= 0 && regs&(1<<uint(f.dstReg)) != 0 {
+				matched = append(matched, f)
+				continue
+			}
+			if f.dstReg < 0 {
+				for a := f.dstMem.Low; a <= f.dstMem.High; a++ {
+					if memory[a] {
+						matched = append(matched, f)
+						break
+					}
+				}
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		// 先去掉这条指令定义的值，再加入它用到的值（目的与源可能是同一个寄存器）
+		for _, f := range matched {
+			if f.dstReg >= 0 {
+				regs &^= 1 << uint(f.dstReg)
+			} else {
+				for a := f.dstMem.Low; a <= f.dstMem.High; a++ {
+					delete(memory, a)
+				}
+			}
+		}
+		for _, f := range matched {
+			regs |= f.srcRegs | f.addrRegs
+			if f.srcMem != nil {
+				for a := f.srcMem.Low; a <= f.srcMem.High; a++ {
+					memory[a] = true
+				}
+			}
+		}
+		wanted[indices[k]] = true
+	}
+
+	// 再扫描一遍取切片中各行的指令
+	if len(wanted) > 0 {
+		err = tm.Scan(func(i int, t *TraceLine) bool {
+			if wanted[i] {
+				s.Lines = append(s.Lines, NewLineRef(i, t))
+			}
+			return len(s.Lines) < len(wanted)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.Unresolved = regs
+	s.memory = len(memory)
+	return s, nil
+}
+
+// Contains 报告第 index 行是否在切片中
+func (s *Slice) Contains(index int) bool {
+	if s == nil {
+		return false
+	}
+	i := sort.Search(len(s.Lines), func(i int) bool { return s.Lines[i].Index >= index })
+	return i < len(s.Lines) && s.Lines[i].Index == index
+}
@@ -0,0 +1,226 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AddrStats 是一个地址的执行统计
+type AddrStats struct {
+	Addr   uint64
+	Offset uint64
+	Instr  string
+	Count  int
+}
+
+// FunctionStats 是一个函数的执行统计，Self 不包括被调函数中执行的指令
+type FunctionStats struct {
+	Entry     uint64
+	Name      string
+	Calls     int
+	Self      int
+	UniquePCs int
+	High      uint64 // 函数内执行过的最高地址
+}
+
+// Coverage 返回执行过的地址占 [Entry, High] 中指令数的比例（函数体不连续时只是近似）
+func (f *FunctionStats) Coverage() float64 {
+	if f.High < f.Entry {
+		return 1
+	}
+	return float64(f.UniquePCs) / float64((f.High-f.Entry)/4+1)
+}
+
+// ModuleStats 是一个模块（按基址区分）的覆盖情况
+type ModuleStats struct {
+	Base      uint64
+	Low, High uint64 // 执行过的最低和最高地址
+	UniquePCs int
+	Pages     map[uint64]bool // 执行过的代码页
+	Count     int
+}
+
+// Stats 是整个 trace 的执行统计
+type Stats struct {
+	Total     int
+	Addrs     map[uint64]*AddrStats
+	Mnemonics map[string]int
+	Functions map[uint64]*FunctionStats
+	Modules   map[uint64]*ModuleStats
+}
+
+// BuildStats 扫描 trace 统计每个地址、助记符、函数和模块的执行次数
+// 指令按影子调用栈的最内层帧归属到函数，函数名取自 BL 日志
+func BuildStats(tm *TraceManager) (*Stats, error) {
+	cs, err := tm.CallStack()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stats{
+		Addrs:     make(map[uint64]*AddrStats),
+		Mnemonics: make(map[string]int),
+		Functions: make(map[uint64]*FunctionStats),
+		Modules:   make(map[uint64]*ModuleStats),
+	}
+	frames := cs.Frames()
+	for _, f := range frames {
+		fs := s.function(f.Target, f.Name())
+		fs.Calls++
+	}
+
+	var root *FunctionStats
+	var open []*CallFrame // 当前的调用栈，内层在后
+	next := 0             // 下一个要进入的帧
+	err = tm.Scan(func(index int, t *TraceLine) bool {
+		if root == nil {
+			root = s.function(t.Addr, fmt.Sprintf("sub_%x", t.Addr))
+		}
+		for next < len(frames) && frames[next].CallIndex < index {
+			open = append(open, frames[next])
+			next++
+		}
+		for len(open) > 0 && open[len(open)-1].RetIndex != -1 && open[len(open)-1].RetIndex < index {
+			open = open[:len(open)-1]
+		}
+		fs := root
+		if n := len(open); n > 0 {
+			fs = s.Functions[open[n-1].Target]
+		}
+		fs.Self++
+
+		a := s.Addrs[t.Addr]
+		if a == nil {
+			a = &AddrStats{Addr: t.Addr, Offset: t.Offset, Instr: t.Instr}
+			s.Addrs[t.Addr] = a
+			fs.UniquePCs++
+			fs.High = max(fs.High, t.Addr)
+		}
+		a.Count++
+		s.Mnemonics[t.Mnemonic()]++
+
+		base := t.Addr - t.Offset
+		m := s.Modules[base]
+		if m == nil {
+			m = &ModuleStats{Base: base, Low: t.Addr, High: t.Addr, Pages: make(map[uint64]bool)}
+			s.Modules[base] = m
+		}
+		if a.Count == 1 {
+			m.UniquePCs++
+		}
+		m.Low = min(m.Low, t.Addr)
+		m.High = max(m.High, t.Addr)
+		m.Pages[pageDown(t.Addr)] = true
+		m.Count++
+
+		s.Total++
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// function 返回入口为 entry 的函数统计，不存在时创建
+func (s *Stats) function(entry uint64, name string) *FunctionStats {
+	fs := s.Functions[entry]
+	if fs == nil {
+		fs = &FunctionStats{Entry: entry, Name: name}
+		s.Functions[entry] = fs
+	}
+	return fs
+}
+
+// TopAddrs 返回执行次数最多的 n 个地址
+func (s *Stats) TopAddrs(n int) []*AddrStats {
+	addrs := make([]*AddrStats, 0, len(s.Addrs))
+	for _, a := range s.Addrs {
+		addrs = append(addrs, a)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].Count != addrs[j].Count {
+			return addrs[i].Count > addrs[j].Count
+		}
+		return addrs[i].Addr < addrs[j].Addr
+	})
+	if len(addrs) > n {
+		addrs = addrs[:n]
+	}
+	return addrs
+}
+
+// percent 返回 count 占总指令数的百分比
+func (s *Stats) percent(count int) float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(count) * 100 / float64(s.Total)
+}
+
+// Format 生成统计报告，每个排行最多列出 top 项
+func (s *Stats) Format(top int) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Instructions: %d  Unique PCs: %d  Functions: %d  Modules: %d\n",
+		s.Total, len(s.Addrs), len(s.Functions), len(s.Modules)))
+
+	sb.WriteString("\nHot addresses\n")
+	for _, a := range s.TopAddrs(top) {
+		sb.WriteString(fmt.Sprintf("  %8d %5.1f%%  0x%x  0x%-8x %s\n", a.Count, s.percent(a.Count), a.Addr, a.Offset, a.Instr))
+	}
+
+	type mnemonic struct {
+		name  string
+		count int
+	}
+	var mns []mnemonic
+	for name, count := range s.Mnemonics {
+		mns = append(mns, mnemonic{name, count})
+	}
+	sort.Slice(mns, func(i, j int) bool {
+		if mns[i].count != mns[j].count {
+			return mns[i].count > mns[j].count
+		}
+		return mns[i].name < mns[j].name
+	})
+	if len(mns) > top {
+		mns = mns[:top]
+	}
+	sb.WriteString("\nMnemonics\n")
+	for _, m := range mns {
+		bar := strings.Repeat("#", int(s.percent(m.count)/2+0.5))
+		sb.WriteString(fmt.Sprintf("  %-8s %8d %5.1f%%  %s\n", m.name, m.count, s.percent(m.count), bar))
+	}
+
+	funcs := make([]*FunctionStats, 0, len(s.Functions))
+	for _, f := range s.Functions {
+		funcs = append(funcs, f)
+	}
+	sort.Slice(funcs, func(i, j int) bool {
+		if funcs[i].Self != funcs[j].Self {
+			return funcs[i].Self > funcs[j].Self
+		}
+		return funcs[i].Entry < funcs[j].Entry
+	})
+	if len(funcs) > top {
+		funcs = funcs[:top]
+	}
+	sb.WriteString("\nFunctions (self instructions)\n")
+	for _, f := range funcs {
+		sb.WriteString(fmt.Sprintf("  %8d %5.1f%%  %6d calls  %5d PCs %5.1f%% covered  0x%x  %s\n",
+			f.Self, s.percent(f.Self), f.Calls, f.UniquePCs, f.Coverage()*100, f.Entry, f.Name))
+	}
+
+	mods := make([]*ModuleStats, 0, len(s.Modules))
+	for _, m := range s.Modules {
+		mods = append(mods, m)
+	}
+	sort.Slice(mods, func(i, j int) bool { return mods[i].Base < mods[j].Base })
+	sb.WriteString("\nModules\n")
+	for _, m := range mods {
+		sb.WriteString(fmt.Sprintf("  base 0x%x  0x%x-0x%x  %d PCs in %d pages  %d instructions (%.1f%%)\n",
+			m.Base, m.Low, m.High, m.UniquePCs, len(m.Pages), m.Count, s.percent(m.Count)))
+	}
+	return sb.String()
+}
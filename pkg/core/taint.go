@@ -0,0 +1,177 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Taint 是一次前向污点传播的结果
+// 只跟踪通用寄存器、SP、条件标志和内存字节，SIMD/浮点寄存器不跟踪
+type Taint struct {
+	Source string
+	Start  int          // 引入污点的行
+	regs   []uint64     // regs[i] 为第 Start+i 行执行前被污染的寄存器
+	Hits   []LineRef    // 读取了被污染数据的行，按行号升序
+	Memory []ValueRange // trace 结束时仍被污染的内存
+}
+
+// TaintRegs 从第 start 行（执行前）开始污染 regs 中的寄存器以及 mem 中的内存，
+// 按指令语义向后传播到 trace 结束
+func (tm *TraceManager) TaintRegs(start int, regs []int, mem []ValueRange, source string) (*Taint, error) {
+	var mask uint64
+	for _, r := range regs {
+		mask |= 1 << uint(r)
+	}
+	memory := make(map[uint64]bool)
+	for _, r := range mem {
+		for addr := r.Low; addr <= r.High && addr >= r.Low; addr++ {
+			memory[addr] = true
+		}
+	}
+
+	ta := &Taint{Source: source, Start: start}
+	err := tm.Scan(func(index int, t *TraceLine) bool {
+		if index < start {
+			return true
+		}
+		// 解析失败被跳过的行沿用之前的状态
+		for len(ta.regs) <= index-start {
+			ta.regs = append(ta.regs, mask)
+		}
+		var hit bool
+		mask, hit = propagateTaint(t, mask, memory, tm.LogManager)
+		if hit {
+			ta.Hits = append(ta.Hits, NewLineRef(index, t))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 最后一行执行后的状态
+	ta.regs = append(ta.regs, mask)
+
+	addrs := make([]uint64, 0, len(memory))
+	for addr, tainted := range memory {
+		if tainted {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	for _, addr := range addrs {
+		if n := len(ta.Memory); n > 0 && ta.Memory[n-1].High+1 == addr {
+			ta.Memory[n-1].High = addr
+			continue
+		}
+		ta.Memory = append(ta.Memory, ValueRange{Low: addr, High: addr})
+	}
+	return ta, nil
+}
+
+// RegsAt 返回第 index 行执行前被污染的寄存器掩码
+func (ta *Taint) RegsAt(index int) uint64 {
+	if ta == nil || index < ta.Start || index-ta.Start >= len(ta.regs) {
+		return 0
+	}
+	return ta.regs[index-ta.Start]
+}
+
+// RegTainted 报告第 index 行执行前寄存器 reg 是否被污染
+func (ta *Taint) RegTainted(index, reg int) bool {
+	return reg >= 0 && ta.RegsAt(index)&(1<<uint(reg)) != 0
+}
+
+// Hit 报告第 index 行是否读取了被污染的数据
+func (ta *Taint) Hit(index int) bool {
+	if ta == nil {
+		return false
+	}
+	i := sort.Search(len(ta.Hits), func(i int) bool { return ta.Hits[i].Index >= index })
+	return i < len(ta.Hits) && ta.Hits[i].Index == index
+}
+
+// propagateTaint 计算执行 t 之后被污染的寄存器，并更新被污染的内存
+// hit 表示这条指令读取了被污染的数据；地址寄存器不传播污点
+func propagateTaint(t *TraceLine, regs uint64, memory map[uint64]bool, lm *LogManager) (uint64, bool) {
+	flows, reads := dataflow(t, lm)
+	hit := regs&reads != 0
+
+	// 先用执行前的状态算出所有结果，再统一写回
+	results := make([]bool, len(flows))
+	for i, f := range flows {
+		on := regs&f.srcRegs != 0
+		if f.srcMem != nil {
+			for a := f.srcMem.Low; a <= f.srcMem.High; a++ {
+				on = on || memory[a]
+			}
+		}
+		results[i] = on
+		hit = hit || on
+	}
+
+	for i, f := range flows {
+		if f.dstReg >= 0 {
+			if results[i] {
+				regs |= 1 << uint(f.dstReg)
+			} else {
+				regs &^= 1 << uint(f.dstReg)
+			}
+			continue
+		}
+		for a := f.dstMem.Low; a <= f.dstMem.High; a++ {
+			if results[i] {
+				memory[a] = true
+			} else {
+				delete(memory, a)
+			}
+		}
+	}
+	return regs, hit
+}
+
+// Format 在结果面板中列出污点传播的结果，最多显示 limit 条指令
+func (ta *Taint) Format(limit int) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[green]taint %s from line %d: %d tainted instruction(s)[-]\n",
+		escapeTags(ta.Source), ta.Start, len(ta.Hits)))
+
+	for i, h := range ta.Hits {
+		if i == limit {
+			sb.WriteString(fmt.Sprintf("[gray]... %d more[-]\n", len(ta.Hits)-limit))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("%6d  0x%x  %s [orange]%s[-]\n",
+			h.Index, h.Addr, escapeTags(fmt.Sprintf("%-32s", h.Instr)), formatRegMask(ta.RegsAt(h.Index+1))))
+	}
+
+	if len(ta.Memory) > 0 {
+		sb.WriteString("\nTainted memory at end of trace:\n")
+		for i, r := range ta.Memory {
+			if i == limit {
+				sb.WriteString(fmt.Sprintf("[gray]... %d more[-]\n", len(ta.Memory)-limit))
+				break
+			}
+			sb.WriteString(fmt.Sprintf("  0x%x-0x%x (%d bytes)\n", r.Low, r.High+1, r.High-r.Low+1))
+		}
+	}
+	return sb.String()
+}
+
+// formatRegMask 列出掩码中的寄存器
+func formatRegMask(mask uint64) string {
+	var names []string
+	for i := 0; i < 32; i++ {
+		if mask&(1<<uint(i)) != 0 {
+			if i == 31 {
+				names = append(names, "sp")
+			} else {
+				names = append(names, fmt.Sprintf("x%d", i))
+			}
+		}
+	}
+	if mask&(1<<RegFlags) != 0 {
+		names = append(names, "nzcv")
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	telescopeDepth = 4  // 指针链最多展开的层数
+	minStringLen   = 4  // 至少这么多可打印字符才当作字符串
+	maxStringShow  = 48 // 字符串最多显示的字符数
+)
+
+// Telescope 像 GEF/pwndbg 的 telescope 一样解引用 value：
+// 指向已知内存中的可打印 ASCII/UTF-16 时返回字符串，指向另一个指针时继续展开
+// value 不指向已知内存时返回空串
+func (m *ShadowMemory) Telescope(value uint64, step int) string {
+	var parts []string
+	seen := make(map[uint64]bool)
+
+	for depth := 0; depth < telescopeDepth; depth++ {
+		if seen[value] {
+			parts = append(parts, "[loop]")
+			break
+		}
+		seen[value] = true
+
+		if s, ok := m.readString(value, step); ok {
+			parts = append(parts, s)
+			break
+		}
+
+		data, known := m.Read(value, 8, step)
+		allKnown := true
+		for _, k := range known {
+			allKnown = allKnown && k
+		}
+		if !allKnown {
+			break
+		}
+
+		var next uint64
+		for i := 7; i >= 0; i-- {
+			next = next<<8 | uint64(data[i])
+		}
+		parts = append(parts, fmt.Sprintf("0x%x", next))
+		if _, ok := m.ByteAt(next, step); !ok {
+			break
+		}
+		value = next
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+	return "→ " + strings.Join(parts, " → ")
+}
+
+// readString 尝试在 addr 处读取 ASCII 或 UTF-16LE 字符串，返回带引号的显示形式
+func (m *ShadowMemory) readString(addr uint64, step int) (string, bool) {
+	// ASCII
+	var ascii strings.Builder
+	n := 0
+	for ; n < 256; n++ {
+		b, ok := m.ByteAt(addr+uint64(n), step)
+		if !ok || b == 0 || !isPrintable(b) {
+			break
+		}
+		if n < maxStringShow {
+			ascii.WriteString(quoteByte(b))
+		}
+	}
+	if n >= minStringLen {
+		return formatString("", ascii.String(), n), true
+	}
+
+	// UTF-16LE（只识别 ASCII 范围内的字符）
+	var wide strings.Builder
+	n = 0
+	for ; n < 256; n++ {
+		lo, okLo := m.ByteAt(addr+uint64(2*n), step)
+		hi, okHi := m.ByteAt(addr+uint64(2*n+1), step)
+		if !okLo || !okHi || hi != 0 || lo == 0 || !isPrintable(lo) {
+			break
+		}
+		if n < maxStringShow {
+			wide.WriteString(quoteByte(lo))
+		}
+	}
+	if n >= minStringLen {
+		return formatString("u", wide.String(), n), true
+	}
+	return "", false
+}
+
+func formatString(prefix, s string, n int) string {
+	if n > maxStringShow {
+		return fmt.Sprintf("%s\"%s\"...", prefix, s)
+	}
+	return fmt.Sprintf("%s\"%s\"", prefix, s)
+}
+
+func isPrintable(b byte) bool {
+	return (b >= 0x20 && b < 0x7f) || b == '\n' || b == '\t'
+}
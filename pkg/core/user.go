@@ -2,10 +2,15 @@ package core
 
 import (
 	"fmt"
+	"os"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+var tagPattern = regexp.MustCompile(`(\[[a-zA-Z0-9_,;: \-\."#]+\[*)\]`)
+
 type CommandType int
 
 const (
@@ -16,11 +21,44 @@ const (
 	CmdClear
 	CmdHelp
 	CmdQuit
-	CmdRun  // 添加运行命令
-	CmdStop // 添加停止命令
-	CmdStep // 添加步进命令
+	CmdRun        // 添加运行命令
+	CmdStop       // 添加停止命令
+	CmdStep       // 添加步进命令
+	CmdUp         // 切换到外层调用帧
+	CmdDown       // 切换到内层调用帧
+	CmdSearch     // 向后搜索指令
+	CmdSearchBack // 向前搜索指令
+	CmdFindValue  // 按寄存器值搜索
+	CmdMark       // 在当前行添加书签
+	CmdUnmark     // 删除书签
+	CmdNote       // 为书签添加备注
+	CmdMarks      // 列出书签
+	CmdJumpMark   // 跳转到书签
+	CmdSession    // 保存会话
+	CmdMemory     // 设置内存视图地址
+	CmdExamine    // x/NFU 查看内存
+	CmdHistory    // 列出某地址范围的读写历史
+	CmdMemDiff    // 比较两步之间的内存
+	CmdVmmap      // 显示推断出的内存区域
+	CmdDump       // 导出重建的内存
+	CmdTaint      // 污点追踪
+	CmdSlice      // 后向数据流切片
+	CmdOrigin     // 跳到寄存器最后一次被写入的位置
+	CmdUses       // 列出寄存器之后被读取的位置
+	CmdCFG        // 显示函数的控制流图
+	CmdLoops      // 列出检测到的循环
+	CmdFold       // 折叠循环
+	CmdUnfold     // 展开循环
+	CmdUntil      // 跳到循环退出处
+	CmdFilter     // 设置过滤规则
+	CmdStats      // 执行统计
+	CmdVM         // 虚拟机分发器与处理函数
+	CmdCrypto     // 密码算法常量扫描
 )
 
+// maxHistory 是保留的命令历史条数
+const maxHistory = 1000
+
 type Command struct {
 	Type CommandType
 	Args []string
@@ -36,6 +74,40 @@ type User struct {
 	LastCommand  *Command // 添加上一个命令
 	RepeatCount  int      // 重复次数计数
 	RegDetector  *RegisterChangeDetector
+
+	FrameLevel      int    // 当前选中的调用帧，0 表示最内层
+	frameOrigin     int    // 开始 up/down 时所在的行
+	frameOriginAddr uint64 // 该行的指令地址
+	callStackErr    error  // 后台构建调用栈失败的原因
+
+	ResultTitle string // 结果面板标题
+	ResultText  string // 结果面板内容
+
+	Bookmarks *BookmarkStore
+	History   []string // 输入过的命令，最早的在前
+
+	MemAddr   uint64 // 内存视图起始地址
+	memPinned bool   // 为 false 时内存视图跟随当前步的读写地址
+	examine   *Examine
+	HelpText  string // help 命令显示的内容
+
+	Taint *Taint // 当前的污点传播结果，nil 表示没有
+	Slice *Slice // 当前的后向切片，nil 表示没有
+
+	folded map[int]bool // 折叠起来的循环，按 Loop.Start 索引
+	Filter *Filter      // 当前的过滤视图，nil 表示显示全部
+	VM     *VM          // 识别出的虚拟机结构，nil 表示没有分析
+	VMView bool         // 汇编视图按处理函数调用显示
+	crypto *CryptoReport
+
+	memHistory *memoryHistoryResult // 最近一次 history 的结果
+
+	origin      *originStep // 最近一次 origin 找到的写入者，供不带参数的 origin 继续回溯
+	originChain []string
+
+	searchPattern  string
+	searchBackward bool // 最近一次 / 或 ? 的方向，供 N 反向重复
+	searchMatches  []LineRef
 }
 
 func NewUser(tm *TraceManager) *User {
@@ -48,6 +120,53 @@ func NewUser(tm *TraceManager) *User {
 		LastCommand:  nil,
 		RepeatCount:  0,
 		RegDetector:  NewRegisterChangeDetector(),
+		Bookmarks:    &BookmarkStore{},
+	}
+}
+
+// Reset 在重新加载 trace 后清空与旧 trace 相关的状态
+func (u *User) Reset() {
+	u.LastCommand = nil
+	u.RepeatCount = 0
+	u.AutoStep = false
+	u.FrameLevel = 0
+	u.callStackErr = nil
+	u.RegDetector = NewRegisterChangeDetector()
+	u.ResultTitle = ""
+	u.ResultText = ""
+	u.searchPattern = ""
+	u.searchMatches = nil
+	u.Bookmarks = &BookmarkStore{}
+	u.MemAddr = 0
+	u.memPinned = false
+	u.examine = nil
+	u.Taint = nil
+	u.Slice = nil
+	u.origin = nil
+	u.originChain = nil
+	u.folded = nil
+	u.Filter = nil
+	u.VM = nil
+	u.VMView = false
+	u.crypto = nil
+	u.memHistory = nil
+}
+
+// showResult 设置结果面板的内容
+func (u *User) showResult(title, text string) {
+	u.ResultTitle = title
+	u.ResultText = text
+}
+
+// Record 把用户在输入框中提交的命令加入历史，快捷键触发的命令不记录
+func (u *User) Record(cmd string) {
+	cmd = strings.TrimSpace(cmd)
+	if cmd == "" {
+		return
+	}
+	u.History = append(u.History, cmd)
+	if len(u.History) > maxHistory {
+		u.History = u.History[len(u.History)-maxHistory:]
 	}
 }
 
@@ -66,6 +185,20 @@ func (u *User) ParseCommand(cmd string) *Command {
 		return nil
 	}
 
+	// 搜索命令：/pattern 向后搜索，?pattern 向前搜索，单独的 / 重复上一次的模式
+	if strings.HasPrefix(cmd, "/") || (strings.HasPrefix(cmd, "?") && len(cmd) > 1) {
+		command := &Command{Type: CmdSearch, Raw: cmd}
+		if cmd[0] == '?' {
+			command.Type = CmdSearchBack
+		}
+		if pattern := cmd[1:]; pattern != "" {
+			command.Args = []string{pattern}
+		}
+		u.LastCommand = command
+		u.RepeatCount = 1
+		return command
+	}
+
 	parts := strings.Fields(cmd)
 	if len(parts) == 0 {
 		return nil
@@ -87,7 +220,8 @@ func (u *User) ParseCommand(cmd string) *Command {
 				cmdPart := baseCmd[:len(baseCmd)-1]
 				numPart := baseCmd[len(baseCmd)-1:]
 				if count, err := strconv.Atoi(numPart); err == nil && count > 0 {
-					// 检查命令类型
+					// 检查命令类型（CmdNext 是零值，不能用 Type 判断是否匹配）
+					matched := true
 					switch cmdPart {
 					case "n", "next":
 						command.Type = CmdNext
@@ -95,8 +229,10 @@ func (u *User) ParseCommand(cmd string) *Command {
 					case "p", "prev", "previous":
 						command.Type = CmdPrev
 						command.Args = []string{strconv.Itoa(count)}
+					default:
+						matched = false
 					}
-					if command.Type == CmdNext || command.Type == CmdPrev {
+					if matched {
 						u.LastCommand = command
 						u.RepeatCount = 1
 						return command
@@ -133,6 +269,70 @@ func (u *User) ParseCommand(cmd string) *Command {
 	case "s", "stop":
 		command.Type = CmdStop
 		u.AutoStep = false
+	case "N":
+		// 按上一次搜索的反方向重复
+		command.Type = CmdSearchBack
+		if u.searchBackward {
+			command.Type = CmdSearch
+		}
+	case "findval":
+		command.Type = CmdFindValue
+	case "mark":
+		command.Type = CmdMark
+	case "unmark":
+		command.Type = CmdUnmark
+	case "note":
+		command.Type = CmdNote
+		// 备注保留原始空白
+		if len(parts) > 2 {
+			text := strings.TrimSpace(strings.TrimPrefix(cmd, parts[0]))
+			text = strings.TrimSpace(strings.TrimPrefix(text, parts[1]))
+			command.Args = []string{parts[1], text}
+		}
+	case "marks":
+		command.Type = CmdMarks
+	case "session":
+		command.Type = CmdSession
+	case "mem", "memory":
+		command.Type = CmdMemory
+	case "history":
+		command.Type = CmdHistory
+	case "memdiff":
+		command.Type = CmdMemDiff
+	case "vmmap":
+		command.Type = CmdVmmap
+	case "dump":
+		command.Type = CmdDump
+	case "taint":
+		command.Type = CmdTaint
+	case "slice":
+		command.Type = CmdSlice
+	case "origin":
+		command.Type = CmdOrigin
+	case "uses":
+		command.Type = CmdUses
+	case "cfg":
+		command.Type = CmdCFG
+	case "loops":
+		command.Type = CmdLoops
+	case "fold":
+		command.Type = CmdFold
+	case "unfold":
+		command.Type = CmdUnfold
+	case "until", "u":
+		command.Type = CmdUntil
+	case "filter":
+		command.Type = CmdFilter
+	case "stats":
+		command.Type = CmdStats
+	case "vm":
+		command.Type = CmdVM
+	case "crypto":
+		command.Type = CmdCrypto
+	case "up":
+		command.Type = CmdUp
+	case "down":
+		command.Type = CmdDown
 	case "step":
 		command.Type = CmdStep
 		if len(parts) > 1 {
@@ -141,6 +341,18 @@ func (u *User) ParseCommand(cmd string) *Command {
 			}
 		}
 	default:
+		// x/NFU <expr> 查看内存
+		if parts[0] == "x" || strings.HasPrefix(parts[0], "x/") {
+			command.Type = CmdExamine
+			command.Args = []string{strings.TrimPrefix(parts[0], "x"), strings.Join(parts[1:], " ")}
+			break
+		}
+		// 'name 跳转到书签
+		if strings.HasPrefix(parts[0], "'") && len(parts[0]) > 1 {
+			command.Type = CmdJumpMark
+			command.Args = []string{parts[0][1:]}
+			break
+		}
 		// 尝试解析为数字，直接跳转到该行
 		if _, err := strconv.Atoi(parts[0]); err == nil {
 			command.Type = CmdGoTo
@@ -149,7 +361,8 @@ func (u *User) ParseCommand(cmd string) *Command {
 	}
 
 	// 保存当前命令（除了help、quit等）
-	if command.Type == CmdNext || command.Type == CmdPrev || command.Type == CmdRun {
+	if command.Type == CmdNext || command.Type == CmdPrev || command.Type == CmdRun ||
+		command.Type == CmdSearch || command.Type == CmdSearchBack {
 		u.LastCommand = command
 		u.RepeatCount = 1
 	} else {
@@ -176,6 +389,9 @@ func (u *User) GetRegisterInfo() string {
 
 	var sb strings.Builder
 
+	// 按指向的区域给寄存器值着色；区域表在加载后由后台构建，完成前不着色
+	regions := u.TraceManager.BuiltRegionMap()
+
 	sb.WriteString("Registers:\n")
 	for i := 0; i < 31; i++ {
 		if i%4 == 0 && i > 0 {
@@ -188,14 +404,13 @@ func (u *User) GetRegisterInfo() string {
 			regChanged = true
 		}
 
-		// 寄存器 x0 可能永远为 0，所以特殊处理
-		if i == 0 && t.Regs[i] == 0 {
+		if u.Taint.RegTainted(u.TraceManager.CurrentIndex, i) {
+			sb.WriteString(formatRegister(fmt.Sprintf("[black:orange]x%2d[-:-]", i), t.Regs[i], regChanged, regions) + "  ")
+		} else if i == 0 && t.Regs[i] == 0 {
+			// 寄存器 x0 可能永远为 0，所以特殊处理
 			sb.WriteString(fmt.Sprintf("[gray]x%2d = 0x%016x[-]  ", i, t.Regs[i]))
-		} else if regChanged {
-			// 变化的寄存器用黄色高亮
-			sb.WriteString(fmt.Sprintf("[yellow]x%2d = 0x%016x[-]  ", i, t.Regs[i]))
 		} else {
-			sb.WriteString(fmt.Sprintf("x%2d = 0x%016x  ", i, t.Regs[i]))
+			sb.WriteString(formatRegister(fmt.Sprintf("x%2d", i), t.Regs[i], regChanged, regions) + "  ")
 		}
 	}
 
@@ -207,16 +422,28 @@ func (u *User) GetRegisterInfo() string {
 	// 检查 PC 是否变化
 	pcChanged := changes[32]
 
-	if spChanged {
-		sb.WriteString(fmt.Sprintf("[yellow]SP  = 0x%016x[-]\n", t.SP))
-	} else {
-		sb.WriteString(fmt.Sprintf("SP  = 0x%016x\n", t.SP))
+	spName := "SP "
+	if u.Taint.RegTainted(u.TraceManager.CurrentIndex, 31) {
+		spName = "[black:orange]SP[-:-] "
 	}
+	sb.WriteString(formatRegister(spName, t.SP, spChanged, regions) + "\n")
+	sb.WriteString(formatRegister("PC ", t.PC, pcChanged, regions))
 
-	if pcChanged {
-		sb.WriteString(fmt.Sprintf("[yellow]PC  = 0x%016x[-]", t.PC))
-	} else {
-		sb.WriteString(fmt.Sprintf("PC  = 0x%016x", t.PC))
+	// 指向已知内存的寄存器：显示字符串或指针链
+	mem := u.TraceManager.LogManager.Memory()
+	var derefs []string
+	for i := 0; i < 32; i++ {
+		value := t.RegisterValue(i)
+		if value == 0 {
+			continue
+		}
+		if chain := mem.Telescope(value, int(t.Step)); chain != "" {
+			derefs = append(derefs, fmt.Sprintf("%-3s 0x%x [gray]%s[-]", u.RegDetector.GetRegisterName(i), value, escapeTags(chain)))
+		}
+	}
+	if len(derefs) > 0 {
+		sb.WriteString("\n\nDereference:\n")
+		sb.WriteString(strings.Join(derefs, "\n"))
 	}
 
 	// 添加命令重复信息
@@ -227,6 +454,28 @@ func (u *User) GetRegisterInfo() string {
 	return sb.String()
 }
 
+// formatRegister 显示一个寄存器：变化的寄存器名用黄色高亮，值按所指向的区域着色
+func formatRegister(name string, value uint64, changed bool, regions *RegionMap) string {
+	valueColor := ""
+	if regions != nil {
+		if r := regions.Find(value); r != nil {
+			valueColor = r.Kind.Color()
+		}
+	}
+	if valueColor == "" && changed {
+		valueColor = "yellow"
+	}
+
+	text := fmt.Sprintf("%s = 0x%016x", name, value)
+	if valueColor != "" {
+		text = fmt.Sprintf("%s = [%s]0x%016x[-]", name, valueColor, value)
+	}
+	if changed {
+		text = "[yellow]" + name + "[-]" + text[len(name):]
+	}
+	return text
+}
+
 func (u *User) ExecuteCommand(cmd *Command) (string, bool) {
 	if cmd == nil {
 		return "", false
@@ -245,7 +494,7 @@ func (u *User) ExecuteCommand(cmd *Command) (string, bool) {
 		}
 
 		for i := 0; i < count; i++ {
-			if u.TraceManager.Next() {
+			if u.step(true) {
 				updated = true
 				if count > 1 && i == count-1 {
 					message = fmt.Sprintf("Stepped %d instructions forward", count)
@@ -273,7 +522,7 @@ func (u *User) ExecuteCommand(cmd *Command) (string, bool) {
 		}
 
 		for i := 0; i < count; i++ {
-			if u.TraceManager.Prev() {
+			if u.step(false) {
 				updated = true
 				if count > 1 && i == count-1 {
 					message = fmt.Sprintf("Stepped %d instructions backward", count)
@@ -295,7 +544,9 @@ func (u *User) ExecuteCommand(cmd *Command) (string, bool) {
 	case CmdGoTo:
 		if len(cmd.Args) > 0 {
 			if line, err := strconv.Atoi(cmd.Args[0]); err == nil {
-				if u.TraceManager.GoTo(line) {
+				// 目标被过滤掉时停在最近的可见行
+				var ok bool
+				if line, ok = u.goTo(line, false); ok {
 					message = fmt.Sprintf("Jumped to line %d", line)
 					updated = true
 				} else {
@@ -319,6 +570,104 @@ func (u *User) ExecuteCommand(cmd *Command) (string, bool) {
 	case CmdStep:
 		message = fmt.Sprintf("Step delay set to %d ms", u.StepDelay)
 
+	case CmdUp, CmdDown:
+		message, updated = u.selectFrame(cmd)
+
+	case CmdSearch, CmdSearchBack:
+		message, updated = u.search(cmd)
+
+	case CmdFindValue:
+		message, updated = u.findValue(cmd)
+
+	case CmdMark, CmdUnmark, CmdNote, CmdMarks, CmdJumpMark:
+		message, updated = u.bookmark(cmd)
+
+	case CmdMemory:
+		u.examine = nil
+		message, updated = u.setMemoryAddress(cmd)
+
+	case CmdExamine:
+		e, err := ParseExamine(cmd.Args[0], cmd.Args[1], u.examine)
+		if err != nil {
+			message = err.Error()
+		} else {
+			u.examine = e
+			updated = true
+		}
+
+	case CmdHistory:
+		message, updated = u.memoryHistory(cmd)
+
+	case CmdMemDiff:
+		message, updated = u.memoryDiff(cmd)
+
+	case CmdDump:
+		message = u.dumpMemory(cmd)
+
+	case CmdTaint:
+		message, updated = u.taint(cmd)
+
+	case CmdSlice:
+		message, updated = u.slice(cmd)
+
+	case CmdOrigin:
+		message, updated = u.findOrigin(cmd)
+
+	case CmdUses:
+		message, updated = u.findUses(cmd)
+
+	case CmdCFG:
+		message, updated = u.showCFG(cmd)
+
+	case CmdLoops, CmdFold, CmdUnfold, CmdUntil:
+		message, updated = u.loopCommand(cmd)
+
+	case CmdFilter:
+		message, updated = u.filter(cmd)
+
+	case CmdVM:
+		message, updated = u.vmCommand(cmd)
+
+	case CmdCrypto:
+		message, updated = u.cryptoScan(cmd)
+
+	case CmdStats:
+		top := 20
+		if len(cmd.Args) > 0 {
+			if n, err := strconv.Atoi(cmd.Args[0]); err == nil && n > 0 {
+				top = n
+			}
+		}
+		if stats, err := BuildStats(u.TraceManager); err != nil {
+			message = fmt.Sprintf("stats failed: %v", err)
+		} else {
+			u.showResult("Stats", escapeTags(stats.Format(top)))
+			message = fmt.Sprintf("%d instructions, %d unique PCs", stats.Total, len(stats.Addrs))
+			updated = true
+		}
+
+	case CmdVmmap:
+		if regions, err := u.TraceManager.RegionMap(); err != nil {
+			message = fmt.Sprintf("vmmap failed: %v", err)
+		} else {
+			u.showResult("vmmap", regions.Format())
+			message = fmt.Sprintf("%d regions inferred", len(regions.Regions))
+			updated = true
+		}
+
+	case CmdHelp:
+		u.showResult("Help", escapeTags(u.HelpText))
+		updated = true
+
+	case CmdSession:
+		if len(cmd.Args) < 2 || cmd.Args[0] != "save" {
+			message = "Usage: session save <file>"
+		} else if err := u.SaveSession(cmd.Args[1]); err != nil {
+			message = fmt.Sprintf("Could not save session: %v", err)
+		} else {
+			message = fmt.Sprintf("Session saved to %s", cmd.Args[1])
+		}
+
 	case CmdQuit:
 		message = "Quitting..."
 
@@ -326,8 +675,132 @@ func (u *User) ExecuteCommand(cmd *Command) (string, bool) {
 		message = ""
 	}
 
+	// 光标被其他命令移动后，回到最内层帧
+	if updated && cmd.Type != CmdUp && cmd.Type != CmdDown {
+		u.FrameLevel = 0
+	}
+
 	return message, updated
 }
+
+// SetCallStack 安装在后台构建好的调用栈，err 不为 nil 时在调用栈面板中显示
+func (u *User) SetCallStack(cs *CallStack, err error) {
+	u.callStackErr = err
+	if err == nil {
+		u.TraceManager.callStack = cs
+	}
+}
+
+// SetRegionMap 安装在后台构建好的区域表
+func (u *User) SetRegionMap(rm *RegionMap) {
+	u.TraceManager.regionMap = rm
+}
+
+// backtrace 返回选中帧所基于的调用栈（外层在前）
+func (u *User) backtrace(cs *CallStack) []*CallFrame {
+	origin := u.TraceManager.CurrentIndex
+	if u.FrameLevel > 0 {
+		origin = u.frameOrigin
+	}
+	return cs.At(origin)
+}
+
+// selectFrame 处理 up/down，把光标移动到所选帧的调用点
+func (u *User) selectFrame(cmd *Command) (string, bool) {
+	count := 1
+	if len(cmd.Args) > 0 {
+		if n, err := strconv.Atoi(cmd.Args[0]); err == nil && n > 0 {
+			count = n
+		}
+	}
+
+	cs, err := u.TraceManager.CallStack()
+	if err != nil {
+		return fmt.Sprintf("Backtrace unavailable: %v", err), false
+	}
+	if u.FrameLevel == 0 {
+		u.frameOrigin = u.TraceManager.CurrentIndex
+		if t := u.TraceManager.GetCurrent(); t != nil {
+			u.frameOriginAddr = t.Addr
+		}
+	}
+	stack := u.backtrace(cs)
+
+	level := u.FrameLevel
+	if cmd.Type == CmdUp {
+		level += count
+	} else {
+		level -= count
+	}
+	if level < 0 {
+		level = 0
+	}
+	if level > len(stack) {
+		level = len(stack)
+	}
+	if level == u.FrameLevel {
+		if cmd.Type == CmdUp {
+			return "Initial frame selected; you cannot go up.", false
+		}
+		return "Bottom (innermost) frame selected; you cannot go down.", false
+	}
+
+	target := u.frameOrigin
+	if level > 0 {
+		target = stack[len(stack)-level].CallIndex
+	}
+	line, ok := u.goTo(target, false)
+	if !ok {
+		return fmt.Sprintf("Invalid line number: %d", target), false
+	}
+	u.FrameLevel = level
+	return fmt.Sprintf("Frame #%d, line %d", level, target) + snapNote(target, line), true
+}
+
+func (u *User) GetBacktraceInfo() string {
+	current := u.TraceManager.GetCurrent()
+	if current == nil {
+		return "No instruction loaded"
+	}
+
+	// 调用栈在加载后由后台构建，完成前不在这里扫描整个 trace
+	cs := u.TraceManager.callStack
+	if cs == nil {
+		if u.callStackErr != nil {
+			return fmt.Sprintf("[red]%v[-]", u.callStackErr)
+		}
+		return "[gray]Building call stack…[-]"
+	}
+	stack := u.backtrace(cs)
+
+	// #0 是最内层函数中的当前位置，#n 是第 n 层调用点
+	var sb strings.Builder
+	for level := 0; level <= len(stack); level++ {
+		name := "??"
+		if level < len(stack) {
+			name = stack[len(stack)-1-level].Name()
+		}
+
+		var line string
+		if level == 0 {
+			addr := current.Addr
+			if u.FrameLevel > 0 {
+				addr = u.frameOriginAddr
+			}
+			line = fmt.Sprintf("#%-2d 0x%012x in %s", level, addr, name)
+		} else {
+			f := stack[len(stack)-level]
+			line = fmt.Sprintf("#%-2d 0x%012x in %s (line %d)", level, f.CallAddr, name, f.CallIndex)
+		}
+
+		if level == u.FrameLevel {
+			sb.WriteString(fmt.Sprintf("[yellow]%s[-]\n", line))
+		} else {
+			sb.WriteString(line + "\n")
+		}
+	}
+	return sb.String()
+}
 func (u *User) GetStatusInfo() string {
 	current := u.TraceManager.GetCurrent()
 	if current == nil {
@@ -355,3 +828,1165 @@ func (u *User) GetStatusInfo() string {
 
 	return info
 }
+
+// search 在整个 trace 中查找下一个（或上一个）匹配的指令并跳转过去
+func (u *User) search(cmd *Command) (string, bool) {
+	backward := cmd.Type == CmdSearchBack
+	pattern := u.searchPattern
+	if len(cmd.Args) > 0 {
+		pattern = cmd.Args[0]
+	}
+	if pattern == "" {
+		return "No previous search pattern", false
+	}
+	if strings.HasPrefix(cmd.Raw, "/") || strings.HasPrefix(cmd.Raw, "?") {
+		u.searchBackward = backward
+	}
+
+	if pattern != u.searchPattern || u.searchMatches == nil {
+		matches, err := u.TraceManager.SearchInstructions(pattern)
+		if err != nil {
+			return fmt.Sprintf("Search failed: %v", err), false
+		}
+		u.searchPattern = pattern
+		u.searchMatches = matches
+	}
+
+	i, wrapped := nextMatch(u.searchMatches, u.TraceManager.CurrentIndex, backward)
+	if i < 0 {
+		u.showResult("Search", fmt.Sprintf("No matches for /%s", escapeTags(pattern)))
+		return fmt.Sprintf("Pattern not found: %s", pattern), true
+	}
+
+	m := u.searchMatches[i]
+	line, _ := u.goTo(m.Index, backward)
+	u.showResult("Search", u.formatSearchResults(i))
+
+	prefix := "/"
+	if backward {
+		prefix = "?"
+	}
+	message := fmt.Sprintf("Match %d/%d for %s%s at line %d", i+1, len(u.searchMatches), prefix, pattern, m.Index) + snapNote(m.Index, line)
+	if wrapped {
+		message += " (wrapped)"
+	}
+	return message, true
+}
+
+// formatSearchResults 列出匹配结果，从当前匹配附近开始显示
+func (u *User) formatSearchResults(current int) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[green]/%s: %d matches[-]\n", escapeTags(u.searchPattern), len(u.searchMatches)))
+
+	start := current - 3
+	if start < 0 {
+		start = 0
+	}
+	end := start + 200
+	if end > len(u.searchMatches) {
+		end = len(u.searchMatches)
+	}
+
+	for i := start; i < end; i++ {
+		m := u.searchMatches[i]
+		line := fmt.Sprintf("%6d | step %-6d | 0x%012x | %s", m.Index, m.Step, m.Addr, escapeTags(m.Instr))
+		if i == current {
+			sb.WriteString(fmt.Sprintf("[yellow]▶ %s[-]\n", line))
+		} else {
+			sb.WriteString(fmt.Sprintf("  %s\n", line))
+		}
+	}
+	if end < len(u.searchMatches) {
+		sb.WriteString(fmt.Sprintf("[gray]... %d more[-]\n", len(u.searchMatches)-end))
+	}
+	return sb.String()
+}
+
+// findValue 处理 findval <value|range> [reg]，列出所有命中并跳到第一次出现的位置
+func (u *User) findValue(cmd *Command) (string, bool) {
+	if len(cmd.Args) == 0 {
+		return "Usage: findval <value|low-high|start+len> [reg]", false
+	}
+	r, err := ParseValueRange(cmd.Args[0])
+	if err != nil {
+		return err.Error(), false
+	}
+	reg := -1
+	if len(cmd.Args) > 1 {
+		if reg = RegisterIndex(cmd.Args[1]); reg < 0 {
+			return fmt.Sprintf("Unknown register: %s", cmd.Args[1]), false
+		}
+	}
+
+	hits, err := u.TraceManager.FindValue(r, reg)
+	if err != nil {
+		return fmt.Sprintf("findval failed: %v", err), false
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[green]findval %s: %d hits[-]\n", r, len(hits)))
+	if len(hits) == 0 {
+		u.showResult("Find Value", sb.String())
+		return fmt.Sprintf("Value %s not found", r), true
+	}
+
+	first := hits[0]
+	sb.WriteString(fmt.Sprintf("[yellow]first: line %d step %d %s = 0x%x | %s[-]\n",
+		first.Index, first.Step, u.RegDetector.GetRegisterName(first.Reg), first.Value, escapeTags(first.Instr)))
+	for i, h := range hits {
+		if i >= 500 {
+			sb.WriteString(fmt.Sprintf("[gray]... %d more[-]\n", len(hits)-i))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("%6d | step %-6d | %-3s = 0x%x (%d lines) | %s\n",
+			h.Index, h.Step, u.RegDetector.GetRegisterName(h.Reg), h.Value, h.Lines, escapeTags(h.Instr)))
+	}
+	u.showResult("Find Value", sb.String())
+
+	line, _ := u.goTo(first.Index, false)
+	return fmt.Sprintf("First appearance of %s in %s at line %d", r, u.RegDetector.GetRegisterName(first.Reg), first.Index) + snapNote(first.Index, line), true
+}
+
+// bookmark 处理书签相关命令，修改后立即写回 sidecar 文件
+func (u *User) bookmark(cmd *Command) (string, bool) {
+	bs := u.Bookmarks
+	name := ""
+	if len(cmd.Args) > 0 {
+		name = cmd.Args[0]
+	}
+
+	var message string
+	switch cmd.Type {
+	case CmdMark:
+		current := u.TraceManager.GetCurrent()
+		if current == nil {
+			return "No instruction loaded", false
+		}
+		if name == "" {
+			return "Usage: mark <name>", false
+		}
+		bs.Set(name, NewLineRef(u.TraceManager.CurrentIndex, current))
+		message = fmt.Sprintf("Marked line %d as '%s", u.TraceManager.CurrentIndex, name)
+
+	case CmdUnmark:
+		if !bs.Remove(name) {
+			return fmt.Sprintf("No bookmark named '%s", name), false
+		}
+		message = fmt.Sprintf("Removed bookmark '%s", name)
+
+	case CmdNote:
+		if len(cmd.Args) < 2 {
+			return "Usage: note <name> <text>", false
+		}
+		m := bs.Get(name)
+		if m == nil {
+			return fmt.Sprintf("No bookmark named '%s", name), false
+		}
+		m.Note = cmd.Args[1]
+		message = fmt.Sprintf("Updated note of '%s", name)
+
+	case CmdMarks:
+		u.showResult("Bookmarks", u.formatBookmarks())
+		return fmt.Sprintf("%d bookmarks", len(bs.Marks)), true
+
+	case CmdJumpMark:
+		m := bs.Get(name)
+		if m == nil {
+			return fmt.Sprintf("No bookmark named '%s", name), false
+		}
+		line, ok := u.goTo(m.Index, false)
+		if !ok {
+			return fmt.Sprintf("Invalid line number: %d", m.Index), false
+		}
+		u.showResult("Bookmarks", u.formatBookmarks())
+		return fmt.Sprintf("Jumped to '%s (line %d)", name, m.Index) + snapNote(m.Index, line), true
+	}
+
+	u.showResult("Bookmarks", u.formatBookmarks())
+	if err := bs.Save(); err != nil {
+		message += fmt.Sprintf(" (save failed: %v)", err)
+	}
+	return message, true
+}
+
+func (u *User) formatBookmarks() string {
+	bs := u.Bookmarks
+	if len(bs.Marks) == 0 {
+		return "No bookmarks. Use: mark <name>"
+	}
+
+	var sb strings.Builder
+	for _, m := range bs.Marks {
+		line := fmt.Sprintf("'%-12s %6d | step %-6d | 0x%012x", m.Name, m.Index, m.Step, m.Addr)
+		if m.Index == u.TraceManager.CurrentIndex {
+			sb.WriteString(fmt.Sprintf("[yellow]▶ %s[-]\n", escapeTags(line)))
+		} else {
+			sb.WriteString(fmt.Sprintf("  %s\n", escapeTags(line)))
+		}
+		if m.Note != "" {
+			sb.WriteString(fmt.Sprintf("    [gray]%s[-]\n", escapeTags(m.Note)))
+		}
+	}
+	return sb.String()
+}
+
+// escapeTags 转义文本中可能被当作颜色标签的方括号（与 tview.Escape 相同的规则）
+func escapeTags(text string) string {
+	return tagPattern.ReplaceAllString(text, "$1[]")
+}
+
+// memoryRows 是内存视图显示的行数（每行 16 字节）
+const memoryRows = 16
+
+// setMemoryAddress 处理 mem [addr|+off|-off]，不带参数时恢复跟随读写地址
+func (u *User) setMemoryAddress(cmd *Command) (string, bool) {
+	if len(cmd.Args) == 0 {
+		u.memPinned = false
+		return "Memory view follows RW accesses", true
+	}
+
+	arg := cmd.Args[0]
+	switch {
+	case strings.HasPrefix(arg, "+"), strings.HasPrefix(arg, "-"):
+		delta, err := strconv.ParseUint(arg[1:], 0, 64)
+		if err != nil {
+			return fmt.Sprintf("Invalid offset: %s", arg), false
+		}
+		u.ScrollMemory(arg[0] == '-', delta)
+	default:
+		addr, err := strconv.ParseUint(arg, 0, 64)
+		if err != nil {
+			return fmt.Sprintf("Invalid address: %s", arg), false
+		}
+		u.MemAddr = addr
+		u.memPinned = true
+	}
+	return fmt.Sprintf("Memory view at 0x%x", u.MemAddr), true
+}
+
+// ScrollMemory 把内存视图前后移动 delta 字节
+func (u *User) ScrollMemory(backward bool, delta uint64) {
+	if backward {
+		u.MemAddr -= delta
+	} else {
+		u.MemAddr += delta
+	}
+	u.memPinned = true
+}
+
+// GetMemoryInfo 以十六进制转储的形式显示当前步已知的内存内容
+// 未知字节显示为 ??，本步发生变化的字节高亮；没有可显示的地址时返回空串
+func (u *User) GetMemoryInfo() string {
+	current := u.TraceManager.GetCurrent()
+	if current == nil {
+		return ""
+	}
+	step := int(current.Step)
+	lm := u.TraceManager.LogManager
+
+	if u.examine != nil {
+		info, err := u.examine.Render(lm.Memory(), current, step, u.writtenAt(current))
+		if err != nil {
+			return fmt.Sprintf("[red]%s[-]", escapeTags(err.Error()))
+		}
+		return info
+	}
+
+	if !u.memPinned {
+		if logs := lm.RwLogs[step]; len(logs) > 0 {
+			u.MemAddr = logs[0].EffectiveAddress()
+		}
+	}
+	if u.MemAddr == 0 {
+		return ""
+	}
+
+	mem := lm.Memory()
+	written := u.writtenAt(current)
+	// 目标地址放在第 memoryRows/4 行
+	start := u.MemAddr &^ 0xf
+	if start >= 0x10*(memoryRows/4) {
+		start -= 0x10 * (memoryRows / 4)
+	}
+
+	var sb strings.Builder
+	mode := "follow RW"
+	if u.memPinned {
+		mode = "pinned"
+	}
+	sb.WriteString(fmt.Sprintf("[green]0x%x @ step %d (%s)[-]\n", u.MemAddr, step, mode))
+
+	for row := 0; row < memoryRows; row++ {
+		addr := start + uint64(row*16)
+		data, known := mem.Read(addr, 16, step)
+
+		var hexPart, asciiPart strings.Builder
+		for i := 0; i < 16; i++ {
+			if i == 8 {
+				hexPart.WriteString(" ")
+			}
+			if !known[i] {
+				hexPart.WriteString("[gray]??[-] ")
+				asciiPart.WriteString(" ")
+				continue
+			}
+			ch := "."
+			if data[i] >= 0x20 && data[i] < 0x7f {
+				ch = string(rune(data[i]))
+			}
+			if written(addr + uint64(i)) {
+				hexPart.WriteString(fmt.Sprintf("[yellow]%02x[-] ", data[i]))
+			} else {
+				hexPart.WriteString(fmt.Sprintf("%02x ", data[i]))
+			}
+			asciiPart.WriteString(ch)
+		}
+
+		marker := "  "
+		if u.MemAddr >= addr && u.MemAddr < addr+16 {
+			marker = "[red]▶[-] "
+		}
+		sb.WriteString(fmt.Sprintf("%s0x%012x: %s |%s|", marker, addr, hexPart.String(), escapeTags(asciiPart.String())))
+
+		// 两个 8 字节单元按指针解引用
+		var derefs []string
+		for off := 0; off < 16; off += 8 {
+			if v, ok := littleEndian(data[off:off+8], known[off:off+8]); ok {
+				if chain := mem.Telescope(v, step); chain != "" {
+					derefs = append(derefs, fmt.Sprintf("+%d %s", off, chain))
+				}
+			}
+		}
+		writeDerefs(&sb, derefs)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// writtenAt 返回判断某地址是否在当前这一步被写入的函数：
+// 影子内存中该字节恰好在这一步变化，或落在本步写日志的访问范围内
+func (u *User) writtenAt(current *TraceLine) func(addr uint64) bool {
+	step := int(current.Step)
+	mem := u.TraceManager.LogManager.Memory()
+
+	size := 8
+	if m := current.Decode().Mem; m != nil {
+		size = m.Size
+	}
+
+	type span struct{ start, end uint64 }
+	var spans []span
+	for _, log := range u.TraceManager.LogManager.RwLogs[step] {
+		if log.Type == "w" {
+			ea := log.EffectiveAddress()
+			spans = append(spans, span{ea, ea + uint64(size)})
+		}
+	}
+
+	return func(addr uint64) bool {
+		for _, s := range spans {
+			if addr >= s.start && addr < s.end {
+				return true
+			}
+		}
+		return mem.ChangedAt(addr, step)
+	}
+}
+
+// memoryHistoryResult 是最近一次 history 的结果，Lines 为能在 trace 中找到的访问所在行（去重、按行号排序）
+type memoryHistoryResult struct {
+	Addr, Size uint64
+	Accesses   []*MemoryAccess
+	Lines      []LineRef
+}
+
+// memoryHistory 处理 history <addr> [len]，列出整个 trace 中触及该范围的读写
+// history next/prev 跳到当前行之后/之前的下一次访问，不带参数时重新显示结果
+func (u *User) memoryHistory(cmd *Command) (string, bool) {
+	tm := u.TraceManager
+	if len(cmd.Args) == 0 {
+		if u.memHistory == nil {
+			return "Usage: history <addr> [len] | history next | history prev", false
+		}
+		u.showResult("Memory History", u.formatMemoryHistory())
+		return "", true
+	}
+	if cmd.Args[0] == "next" || cmd.Args[0] == "prev" {
+		h := u.memHistory
+		if h == nil || len(h.Lines) == 0 {
+			return "No memory history", false
+		}
+		i, wrapped := nextMatch(h.Lines, tm.CurrentIndex, cmd.Args[0] == "prev")
+		line, _ := u.goTo(h.Lines[i].Index, cmd.Args[0] == "prev")
+		u.showResult("Memory History", u.formatMemoryHistory())
+		message := fmt.Sprintf("Access %d/%d at line %d", i+1, len(h.Lines), h.Lines[i].Index) + snapNote(h.Lines[i].Index, line)
+		if wrapped {
+			message += " (wrapped)"
+		}
+		return message, true
+	}
+
+	addr, err := EvalExpr(cmd.Args[0], tm.GetCurrent())
+	if err != nil {
+		return err.Error(), false
+	}
+	size := uint64(1)
+	if len(cmd.Args) > 1 {
+		if size, err = strconv.ParseUint(cmd.Args[1], 0, 64); err != nil || size == 0 {
+			return fmt.Sprintf("Invalid length: %s", cmd.Args[1]), false
+		}
+	}
+
+	accesses, err := tm.MemoryHistory(addr, size)
+	if err != nil {
+		return fmt.Sprintf("history failed: %v", err), false
+	}
+	h := &memoryHistoryResult{Addr: addr, Size: size, Accesses: accesses}
+	for _, a := range accesses {
+		if a.HasLine {
+			h.Lines = append(h.Lines, a.LineRef)
+		}
+	}
+	sort.Slice(h.Lines, func(i, j int) bool { return h.Lines[i].Index < h.Lines[j].Index })
+	n := 0
+	for i, l := range h.Lines {
+		if i == 0 || l.Index != h.Lines[n-1].Index {
+			h.Lines[n] = l
+			n++
+		}
+	}
+	h.Lines = h.Lines[:n]
+	u.memHistory = h
+
+	u.showResult("Memory History", u.formatMemoryHistory())
+	return fmt.Sprintf("%d accesses to 0x%x+0x%x", len(accesses), addr, size), true
+}
+
+// formatMemoryHistory 列出最近一次 history 的结果，当前行上的访问用 ▶ 标出
+func (u *User) formatMemoryHistory() string {
+	h := u.memHistory
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[green]history 0x%x+0x%x: %d accesses (history next/prev to jump)[-]\n", h.Addr, h.Size, len(h.Accesses)))
+	for _, a := range h.Accesses {
+		line := "     ?"
+		if a.HasLine {
+			line = fmt.Sprintf("%6d", a.Index)
+		}
+
+		typeColor := "green"
+		if a.Type == "w" {
+			typeColor = "red"
+		}
+
+		values := formatBytes(a.After, a.KnownAfter)
+		if a.Type == "w" {
+			values = formatBytes(a.Before, a.KnownBefore) + " -> " + values
+		}
+
+		marker := "  "
+		if a.HasLine && a.Index == u.TraceManager.CurrentIndex {
+			marker = "[yellow]▶[-] "
+		}
+		sb.WriteString(fmt.Sprintf("%s%s | step %-6d | [%s]%s[-] 0x%x/%d | %s | %s\n",
+			marker, line, a.Step, typeColor, strings.ToUpper(a.Type), a.Address, a.Size, values, escapeTags(a.Instr)))
+	}
+	return sb.String()
+}
+
+// formatBytes 以十六进制显示字节，未知字节显示为 ??
+func formatBytes(data []byte, known []bool) string {
+	var sb strings.Builder
+	for i, b := range data {
+		if known[i] {
+			sb.WriteString(fmt.Sprintf("%02x", b))
+		} else {
+			sb.WriteString("[gray]??[-]")
+		}
+	}
+	return sb.String()
+}
+
+// maxDiffRows 是 memdiff 最多显示的行数
+const maxDiffRows = 256
+
+// memoryDiff 处理 memdiff <stepA> <stepB> [range]，并排显示两步之间变化的字节
+func (u *User) memoryDiff(cmd *Command) (string, bool) {
+	if len(cmd.Args) < 2 {
+		return "Usage: memdiff <stepA> <stepB> [start-end|start+len]", false
+	}
+	stepA, errA := strconv.ParseInt(cmd.Args[0], 0, 64)
+	stepB, errB := strconv.ParseInt(cmd.Args[1], 0, 64)
+	if errA != nil || errB != nil {
+		return "Invalid step number", false
+	}
+
+	var scope []ValueRange
+	if len(cmd.Args) > 2 {
+		r, err := ParseValueRange(cmd.Args[2])
+		if err != nil {
+			return err.Error(), false
+		}
+		scope = append(scope, r)
+	}
+
+	rows := u.TraceManager.LogManager.Memory().Diff(int(stepA), int(stepB), scope)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[green]memdiff step %d -> step %d: %d rows differ[-]\n", stepA, stepB, len(rows)))
+	for i, row := range rows {
+		if i >= maxDiffRows {
+			sb.WriteString(fmt.Sprintf("[gray]... %d more rows[-]\n", len(rows)-i))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("0x%012x: %s | %s\n", row.Addr,
+			formatDiffSide(row.A, row.KnownA, row.Diff, row.InScope, "red"),
+			formatDiffSide(row.B, row.KnownB, row.Diff, row.InScope, "green")))
+	}
+	u.showResult("Memory Diff", sb.String())
+	return fmt.Sprintf("%d rows differ between step %d and step %d", len(rows), stepA, stepB), true
+}
+
+// formatDiffSide 显示 memdiff 的一侧，不同的字节用 color 高亮
+func formatDiffSide(data [16]byte, known, diff, inScope [16]bool, color string) string {
+	var sb strings.Builder
+	for i := 0; i < 16; i++ {
+		switch {
+		case !inScope[i]:
+			sb.WriteString("  ")
+		case !known[i]:
+			sb.WriteString("[gray]??[-]")
+		case diff[i]:
+			sb.WriteString(fmt.Sprintf("[%s]%02x[-]", color, data[i]))
+		default:
+			sb.WriteString(fmt.Sprintf("%02x", data[i]))
+		}
+		if i%4 == 3 && i != 15 {
+			sb.WriteString(" ")
+		}
+	}
+	return sb.String()
+}
+
+// dumpMemory 处理 dump memory <file> <start> <end> [@step]，step 默认为当前步
+func (u *User) dumpMemory(cmd *Command) string {
+	args := cmd.Args
+	if len(args) < 4 || args[0] != "memory" {
+		return "Usage: dump memory <file> <start> <end> [@step]"
+	}
+
+	current := u.TraceManager.GetCurrent()
+	start, err := EvalExpr(args[2], current)
+	if err != nil {
+		return err.Error()
+	}
+	end, err := EvalExpr(args[3], current)
+	if err != nil {
+		return err.Error()
+	}
+
+	var step int
+	switch {
+	case len(args) > 4:
+		s, err := strconv.ParseInt(strings.TrimPrefix(args[4], "@"), 0, 64)
+		if err != nil {
+			return fmt.Sprintf("Invalid step: %s", args[4])
+		}
+		step = int(s)
+	case current != nil:
+		step = int(current.Step)
+	default:
+		return "No instruction loaded"
+	}
+
+	known, err := u.TraceManager.LogManager.Memory().Dump(args[1], start, end, step)
+	if err != nil {
+		return fmt.Sprintf("dump failed: %v", err)
+	}
+	return fmt.Sprintf("Dumped 0x%x bytes (%d known) at step %d to %s (+%s)", end-start, known, step, args[1], DumpMaskSuffix)
+}
+
+// maxTaintMemory 限制 taint mem 一次引入的字节数
+const maxTaintMemory = 1 << 20
+
+// taint 处理 taint <reg>...、taint mem <start> <len>、taint clear，
+// 污点从当前行开始向后传播
+func (u *User) taint(cmd *Command) (string, bool) {
+	tm := u.TraceManager
+	args := cmd.Args
+	if len(args) == 0 {
+		if u.Taint == nil {
+			return "Usage: taint <reg>... | taint mem <start> <len> | taint clear", false
+		}
+		u.showResult("Taint", u.Taint.Format(500))
+		return "", true
+	}
+
+	current := tm.GetCurrent()
+	if current == nil {
+		return "No instruction loaded", false
+	}
+
+	var regs []int
+	var mem []ValueRange
+	switch args[0] {
+	case "clear":
+		u.Taint = nil
+		return "Taint cleared", true
+	case "mem":
+		if len(args) < 3 {
+			return "Usage: taint mem <start> <len>", false
+		}
+		start, err := EvalExpr(args[1], current)
+		if err != nil {
+			return err.Error(), false
+		}
+		n, err := EvalExpr(args[2], current)
+		if err != nil {
+			return err.Error(), false
+		}
+		if n == 0 || n > maxTaintMemory {
+			return fmt.Sprintf("Invalid length: 0x%x", n), false
+		}
+		mem = append(mem, ValueRange{Low: start, High: start + n - 1})
+	default:
+		for _, name := range args {
+			idx := RegisterIndex(name)
+			if idx < 0 || idx > 31 {
+				return fmt.Sprintf("Unknown register: %s", name), false
+			}
+			regs = append(regs, idx)
+		}
+	}
+
+	ta, err := tm.TaintRegs(tm.CurrentIndex, regs, mem, strings.Join(args, " "))
+	if err != nil {
+		return fmt.Sprintf("taint failed: %v", err), false
+	}
+	u.Taint = ta
+	u.showResult("Taint", ta.Format(500))
+	return fmt.Sprintf("%d tainted instructions", len(ta.Hits)), true
+}
+
+// slice 处理 slice <reg>、slice next/prev、slice clear，不带参数时重新显示切片
+func (u *User) slice(cmd *Command) (string, bool) {
+	tm := u.TraceManager
+	args := cmd.Args
+	if len(args) == 0 {
+		if u.Slice == nil {
+			return "Usage: slice <reg> | slice next | slice prev | slice clear", false
+		}
+		i, _ := nextMatch(u.Slice.Lines, tm.CurrentIndex-1, false)
+		u.showResult("Slice", u.formatSlice(i))
+		return "", true
+	}
+
+	switch args[0] {
+	case "clear":
+		u.Slice = nil
+		return "Slice cleared", true
+	case "next", "prev":
+		if u.Slice == nil || len(u.Slice.Lines) == 0 {
+			return "No slice", false
+		}
+		i, wrapped := nextMatch(u.Slice.Lines, tm.CurrentIndex, args[0] == "prev")
+		line, _ := u.goTo(u.Slice.Lines[i].Index, args[0] == "prev")
+		u.showResult("Slice", u.formatSlice(i))
+		message := fmt.Sprintf("Slice %d/%d at line %d", i+1, len(u.Slice.Lines), u.Slice.Lines[i].Index) + snapNote(u.Slice.Lines[i].Index, line)
+		if wrapped {
+			message += " (wrapped)"
+		}
+		return message, true
+	}
+
+	reg := RegisterIndex(args[0])
+	if reg < 0 || reg > 31 {
+		return fmt.Sprintf("Unknown register: %s", args[0]), false
+	}
+	s, err := tm.BackwardSlice(tm.CurrentIndex, reg, args[0])
+	if err != nil {
+		return fmt.Sprintf("slice failed: %v", err), false
+	}
+	u.Slice = s
+	u.showResult("Slice", u.formatSlice(-1))
+	return fmt.Sprintf("%d instructions in slice of %s at line %d", len(s.Lines), args[0], s.Index), true
+}
+
+// formatSlice 列出切片中的指令，current 为当前所在的切片下标
+func (u *User) formatSlice(current int) string {
+	s := u.Slice
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[green]slice %s at line %d: %d instructions[-]\n", escapeTags(s.Target), s.Index, len(s.Lines)))
+	if s.Unresolved != 0 || s.memory > 0 {
+		var roots []string
+		if s.Unresolved != 0 {
+			roots = append(roots, formatRegMask(s.Unresolved))
+		}
+		if s.memory > 0 {
+			roots = append(roots, fmt.Sprintf("%d memory bytes", s.memory))
+		}
+		sb.WriteString(fmt.Sprintf("[gray]reaches trace start: %s[-]\n", strings.Join(roots, ", ")))
+	}
+
+	start := current - 3
+	if start < 0 {
+		start = 0
+	}
+	end := start + 500
+	if end > len(s.Lines) {
+		end = len(s.Lines)
+	}
+	for i := start; i < end; i++ {
+		l := s.Lines[i]
+		line := fmt.Sprintf("%6d | 0x%012x | %s", l.Index, l.Addr, escapeTags(l.Instr))
+		if i == current {
+			sb.WriteString(fmt.Sprintf("[yellow]▶ %s[-]\n", line))
+		} else {
+			sb.WriteString(fmt.Sprintf("  %s\n", line))
+		}
+	}
+	if end < len(s.Lines) {
+		sb.WriteString(fmt.Sprintf("[gray]... %d more[-]\n", len(s.Lines)-end))
+	}
+	return sb.String()
+}
+
+// originStep 是 origin 回溯链上的一环：第 index 行的 writer 写入了 reg
+type originStep struct {
+	reg    int
+	index  int
+	writer *TraceLine
+}
+
+// findOrigin 处理 origin <reg>：跳到当前行之前最后一次改变 reg 的指令
+// 不带参数时沿上一次找到的指令的第一个源寄存器继续向前回溯
+func (u *User) findOrigin(cmd *Command) (string, bool) {
+	tm := u.TraceManager
+	names := u.RegDetector
+	var reg, from int
+
+	if len(cmd.Args) > 0 {
+		reg = RegisterIndex(cmd.Args[0])
+		if reg < 0 || reg > 31 {
+			return fmt.Sprintf("Unknown register: %s", cmd.Args[0]), false
+		}
+		from = tm.CurrentIndex
+		u.originChain = nil
+	} else {
+		if u.origin == nil {
+			return "Usage: origin <reg>", false
+		}
+		prev := u.origin
+		src, fromMemory := SourceRegister(prev.writer, prev.reg, tm.LogManager)
+		if src < 0 {
+			what := "an immediate"
+			if fromMemory {
+				what = "memory (see history)"
+			}
+			return fmt.Sprintf("%s at line %d comes from %s", names.GetRegisterName(prev.reg), prev.index, what), false
+		}
+		reg, from = src, prev.index
+	}
+
+	writer, index, value, err := tm.LastWrite(from, reg)
+	if err != nil {
+		return fmt.Sprintf("origin failed: %v", err), false
+	}
+	name := names.GetRegisterName(reg)
+	if index < 0 {
+		return fmt.Sprintf("%s is not changed before line %d", name, from), false
+	}
+
+	u.origin = &originStep{reg: reg, index: index, writer: writer}
+	u.originChain = append(u.originChain, fmt.Sprintf("%6d | 0x%012x | %-32s %s = 0x%x",
+		index, writer.Addr, writer.Instr, name, value))
+	line, _ := u.goTo(index, true)
+
+	var sb strings.Builder
+	sb.WriteString("[green]origin chain (repeat origin to follow the first source)[-]\n")
+	for _, line := range u.originChain {
+		sb.WriteString("  " + escapeTags(line) + "\n")
+	}
+	u.showResult("Origin", sb.String())
+	return fmt.Sprintf("%s last written at line %d", name, index) + snapNote(index, line), true
+}
+
+// findUses 处理 uses <reg>：列出从当前行开始读取 reg 的指令，直到它被覆盖
+func (u *User) findUses(cmd *Command) (string, bool) {
+	if len(cmd.Args) == 0 {
+		return "Usage: uses <reg>", false
+	}
+	reg := RegisterIndex(cmd.Args[0])
+	if reg < 0 || reg > 31 {
+		return fmt.Sprintf("Unknown register: %s", cmd.Args[0]), false
+	}
+
+	tm := u.TraceManager
+	uses, overwritten, err := tm.NextUses(tm.CurrentIndex, reg, 500)
+	if err != nil {
+		return fmt.Sprintf("uses failed: %v", err), false
+	}
+
+	name := u.RegDetector.GetRegisterName(reg)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[green]uses of %s from line %d: %d[-]\n", name, tm.CurrentIndex, len(uses)))
+	for _, l := range uses {
+		sb.WriteString(fmt.Sprintf("  %6d | 0x%012x | %s\n", l.Index, l.Addr, escapeTags(l.Instr)))
+	}
+	if overwritten >= 0 {
+		sb.WriteString(fmt.Sprintf("[gray]overwritten at line %d[-]\n", overwritten))
+	}
+	u.showResult("Uses", sb.String())
+	return fmt.Sprintf("%d uses of %s", len(uses), name), true
+}
+
+// showCFG 处理 cfg [func] [export <file>]，不指定函数时使用当前行所在的函数
+// export 把控制流图写入文件，按扩展名选择 DOT 或 Mermaid
+func (u *User) showCFG(cmd *Command) (string, bool) {
+	tm := u.TraceManager
+	g, err := tm.CFG()
+	if err != nil {
+		return fmt.Sprintf("cfg failed: %v", err), false
+	}
+
+	args := cmd.Args
+	var entry uint64
+	if len(args) > 0 && args[0] != "export" {
+		var ok bool
+		if entry, ok = g.FindFunction(args[0]); !ok {
+			return fmt.Sprintf("Unknown function: %s", args[0]), false
+		}
+		args = args[1:]
+	} else {
+		entry = g.Root
+		if cs, err := tm.CallStack(); err == nil {
+			if frames := cs.At(tm.CurrentIndex); len(frames) > 0 {
+				entry = frames[len(frames)-1].Target
+			}
+		}
+	}
+
+	fg := g.Function(entry)
+	if len(args) > 0 {
+		if args[0] != "export" || len(args) < 2 {
+			return "Usage: cfg <func> [export <file>]", false
+		}
+		format, _ := ExportFormat("", args[1])
+		text := g.DOT(entry)
+		if format == "mermaid" {
+			text = g.Mermaid(entry)
+		}
+		if err := os.WriteFile(args[1], []byte(text), 0644); err != nil {
+			return fmt.Sprintf("export failed: %v", err), false
+		}
+		return fmt.Sprintf("CFG of %s written to %s", fg.Name, args[1]), false
+	}
+
+	u.showResult("CFG "+fg.Name, escapeTags(fg.Render()))
+	return fmt.Sprintf("%s: %d blocks, %d edges", fg.Name, len(fg.Blocks), len(fg.Edges)), true
+}
+
+// FoldedLoop 返回包含第 index 行且已折叠的循环，没有时返回 nil
+func (u *User) FoldedLoop(index int) *Loop {
+	if len(u.folded) == 0 {
+		return nil
+	}
+	loops, err := u.TraceManager.Loops()
+	if err != nil {
+		return nil
+	}
+	if l := FindLoop(loops, index); l != nil && u.folded[l.Start] {
+		return l
+	}
+	return nil
+}
+
+// loopCommand 处理 loops / fold / unfold / until：
+// fold 和 unfold 默认作用于当前行所在的循环，带 all 时作用于全部循环
+func (u *User) loopCommand(cmd *Command) (string, bool) {
+	tm := u.TraceManager
+	loops, err := tm.Loops()
+	if err != nil {
+		return fmt.Sprintf("loop detection failed: %v", err), false
+	}
+	current := FindLoop(loops, tm.CurrentIndex)
+
+	switch cmd.Type {
+	case CmdLoops:
+		if len(loops) == 0 {
+			return "No loops detected", false
+		}
+		u.showResult(fmt.Sprintf("Loops (%d)", len(loops)), escapeTags(FormatLoops(loops, tm.CurrentIndex, u.folded)))
+		return fmt.Sprintf("%d loops detected", len(loops)), true
+
+	case CmdFold, CmdUnfold:
+		fold := cmd.Type == CmdFold
+		if len(cmd.Args) > 0 && cmd.Args[0] == "all" {
+			u.folded = nil
+			if fold {
+				u.folded = make(map[int]bool, len(loops))
+				for _, l := range loops {
+					u.folded[l.Start] = true
+				}
+				return fmt.Sprintf("Folded %d loops", len(loops)), true
+			}
+			return "Expanded all loops", true
+		}
+		if current == nil {
+			return "Not inside a loop", false
+		}
+		if fold {
+			if u.folded == nil {
+				u.folded = make(map[int]bool)
+			}
+			u.folded[current.Start] = true
+			return "Folded " + current.String(), true
+		}
+		delete(u.folded, current.Start)
+		return "Expanded " + current.String(), true
+
+	default: // CmdUntil
+		if current == nil {
+			return "Not inside a loop", false
+		}
+		if current.End >= tm.Total() {
+			return "Loop runs until the end of the trace", false
+		}
+		remaining := current.Iterations - current.Iteration(tm.CurrentIndex) + 1
+		line, _ := u.goTo(current.End, false)
+		return fmt.Sprintf("Skipped %d remaining iterations of %s", remaining, current) + snapNote(current.End, line), true
+	}
+}
+
+// step 前进或后退一条可见的指令，按处理函数显示时前进或后退一次分发
+func (u *User) step(forward bool) bool {
+	tm := u.TraceManager
+	if u.VM != nil && u.VMView {
+		cmd := &Command{Type: CmdVM, Args: []string{"prev"}}
+		if forward {
+			cmd.Args[0] = "next"
+		}
+		_, ok := u.vmCommand(cmd)
+		return ok
+	}
+	if u.Filter == nil {
+		if forward {
+			return tm.Next()
+		}
+		return tm.Prev()
+	}
+	i := u.Filter.Prev(tm.CurrentIndex)
+	if forward {
+		i = u.Filter.Next(tm.CurrentIndex)
+	}
+	return i >= 0 && tm.GoTo(i)
+}
+
+// visibleLine 返回过滤视图中离 index 最近的可见行，没有过滤或 index 本身可见时返回 index
+// backward 为 true 时优先取之前的行，这样向前翻找匹配时不会又被吸回刚离开的位置
+func (u *User) visibleLine(index int, backward bool) int {
+	f := u.Filter
+	if f == nil || f.Contains(index) || index < 0 || index >= u.TraceManager.Total() {
+		return index
+	}
+	if backward {
+		if i := f.Prev(index); i >= 0 {
+			return i
+		}
+	}
+	if i := f.Nearest(index); i >= 0 {
+		return i
+	}
+	return index
+}
+
+// goTo 跳到第 index 行，目标被过滤掉时停在最近的可见行，返回实际所在的行
+func (u *User) goTo(index int, backward bool) (int, bool) {
+	index = u.visibleLine(index, backward)
+	return index, u.TraceManager.GoTo(index)
+}
+
+// snapNote 在跳转目标被过滤掉、实际停在 line 时给出提示
+func snapNote(target, line int) string {
+	if target == line {
+		return ""
+	}
+	return fmt.Sprintf(" (line %d is filtered, at %d)", target, line)
+}
+
+// filter 处理 filter 命令：不带参数列出规则，clear 清除全部规则，其余参数追加一条规则
+func (u *User) filter(cmd *Command) (string, bool) {
+	tm := u.TraceManager
+	if len(cmd.Args) == 0 {
+		if u.Filter == nil {
+			return "No filter", false
+		}
+		u.showResult("Filter", escapeTags(u.Filter.Format()))
+		return fmt.Sprintf("%d of %d lines visible", len(u.Filter.Visible), u.Filter.Total), true
+	}
+	if cmd.Args[0] == "clear" || cmd.Args[0] == "off" {
+		u.Filter = nil
+		return "Filter cleared", true
+	}
+
+	rule, err := ParseFilterRule(cmd.Args, tm)
+	if err != nil {
+		return fmt.Sprintf("filter: %v", err), false
+	}
+	var rules []*FilterRule
+	if u.Filter != nil {
+		rules = append(rules, u.Filter.Rules...)
+	}
+	f, err := NewFilter(tm, append(rules, rule))
+	if err != nil {
+		return fmt.Sprintf("filter failed: %v", err), false
+	}
+	if len(f.Visible) == 0 {
+		return fmt.Sprintf("filter %s would hide every line", rule), false
+	}
+	u.Filter = f
+	if i := f.Nearest(tm.CurrentIndex); i != tm.CurrentIndex {
+		tm.GoTo(i)
+	}
+	return fmt.Sprintf("filter %s: %d of %d lines visible", rule, len(f.Visible), f.Total), true
+}
+
+// vmCommand 处理 vm 命令：
+// vm [dispatcher] 识别分发器并列出处理函数，vm view 切换按处理函数显示，
+// vm next/prev [handler] 跳到下一次 / 上一次（该处理函数的）调用，vm clear 清除
+func (u *User) vmCommand(cmd *Command) (string, bool) {
+	tm := u.TraceManager
+	sub := ""
+	if len(cmd.Args) > 0 {
+		sub = cmd.Args[0]
+	}
+
+	switch sub {
+	case "clear":
+		u.VM = nil
+		u.VMView = false
+		return "VM analysis cleared", true
+	case "", "view", "next", "prev":
+		if u.VM == nil {
+			vm, err := tm.VM()
+			if err != nil {
+				return fmt.Sprintf("vm: %v", err), false
+			}
+			u.VM = vm
+		}
+	default:
+		addr, err := strconv.ParseUint(sub, 0, 64)
+		if err != nil {
+			return "Usage: vm [dispatcher|view|next|prev|clear]", false
+		}
+		vm, err := AnalyzeVM(tm, addr)
+		if err != nil {
+			return fmt.Sprintf("vm failed: %v", err), false
+		}
+		if len(vm.Invocations) == 0 {
+			return fmt.Sprintf("0x%x never dispatches", addr), false
+		}
+		u.VM = vm
+	}
+	vm := u.VM
+
+	switch sub {
+	case "view":
+		u.VMView = !u.VMView
+		if u.VMView {
+			return fmt.Sprintf("Showing %d handler invocations", len(vm.Invocations)), true
+		}
+		return "Showing native instructions", true
+
+	case "next", "prev":
+		var handler *VMHandler
+		if len(cmd.Args) > 1 {
+			if handler = vm.FindHandler(cmd.Args[1]); handler == nil {
+				return fmt.Sprintf("Unknown handler: %s", cmd.Args[1]), false
+			}
+		}
+		cur := vm.InvocationAt(tm.CurrentIndex)
+		step := 1
+		if sub == "prev" {
+			step = -1
+		}
+		i := cur + step
+		if cur < 0 {
+			// 不在任何调用中：从当前行之后（之前）的第一次调用开始
+			i = sort.Search(len(vm.Invocations), func(i int) bool { return vm.Invocations[i].Start > tm.CurrentIndex })
+			if step < 0 {
+				i--
+			}
+		}
+		for ; i >= 0 && i < len(vm.Invocations); i += step {
+			inv := vm.Invocations[i]
+			if handler != nil && inv.Handler != handler {
+				continue
+			}
+			// 过滤视图中跳过整个被隐藏的调用，停在调用中第一条可见的指令
+			line := inv.Start
+			if u.Filter != nil {
+				if line = u.Filter.Next(inv.Start - 1); line < 0 || line >= inv.End {
+					continue
+				}
+			}
+			tm.GoTo(line)
+			return fmt.Sprintf("Dispatch #%d: %s @0x%x", i, inv.Handler.Name(), inv.Handler.Entry), true
+		}
+		return "No more handler invocations", false
+
+	default:
+		u.showResult("VM", escapeTags(vm.Format()))
+		return fmt.Sprintf("Dispatcher 0x%x: %d handlers, %d dispatches", vm.Dispatcher, len(vm.Handlers), len(vm.Invocations)), true
+	}
+}
+
+// cryptoScan 处理 crypto 命令：扫描密码算法常量并列出结果，crypto next/prev 在命中的行之间跳转
+func (u *User) cryptoScan(cmd *Command) (string, bool) {
+	tm := u.TraceManager
+	if u.crypto == nil {
+		report, err := ScanCrypto(tm)
+		if err != nil {
+			return fmt.Sprintf("crypto scan failed: %v", err), false
+		}
+		u.crypto = report
+	}
+	report := u.crypto
+	if len(report.Hits) == 0 {
+		return "No crypto constants found", false
+	}
+
+	if len(cmd.Args) > 0 && (cmd.Args[0] == "next" || cmd.Args[0] == "prev") {
+		lines := report.Lines()
+		var target int
+		if cmd.Args[0] == "next" {
+			i := sort.SearchInts(lines, tm.CurrentIndex+1)
+			if i == len(lines) {
+				return "No more crypto constants", false
+			}
+			target = lines[i]
+		} else {
+			i := sort.SearchInts(lines, tm.CurrentIndex)
+			if i == 0 {
+				return "No more crypto constants", false
+			}
+			target = lines[i-1]
+		}
+		line, _ := u.goTo(target, cmd.Args[0] == "prev")
+		var names []string
+		seen := make(map[string]bool)
+		for _, h := range report.Hits {
+			if name := h.Algorithm + " " + h.Name; h.FirstIndex == target && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		return fmt.Sprintf("Line %d: %s", target, strings.Join(names, ", ")) + snapNote(target, line), true
+	}
+
+	algorithms := make(map[string]bool)
+	for _, h := range report.Hits {
+		algorithms[h.Algorithm] = true
+	}
+	u.showResult("Crypto", escapeTags(report.Format()))
+	return fmt.Sprintf("%d crypto constants of %d algorithms", len(report.Hits), len(algorithms)), true
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const maxHandlerPreview = 4 // 处理函数摘要中保留的指令数
+
+// VMHandler 是分发器跳转到的一个处理函数（虚拟指令的实现）
+type VMHandler struct {
+	ID      int      // 按第一次出现的顺序编号
+	Entry   uint64   // 入口地址
+	Count   int      // 被分发的次数
+	Instrs  int      // 所有调用中执行的指令总数
+	Preview []string // 第一次调用时执行的开头几条指令，到第一条分支为止
+
+	previewDone bool
+}
+
+// Name 返回处理函数的显示名
+func (h *VMHandler) Name() string {
+	return fmt.Sprintf("H%d", h.ID)
+}
+
+// VMInvocation 是一次分发：从处理函数入口到下一次执行分发器之前
+type VMInvocation struct {
+	Handler *VMHandler
+	Start   int // 处理函数第一条指令所在行
+	End     int // 下一次分发所在行（不含），最后一次为 trace 结尾
+	Step    uint32
+}
+
+// VM 是识别出的虚拟机结构：分发器所在的间接跳转以及由它分发的处理函数序列
+type VM struct {
+	Dispatcher  uint64
+	DispatchIns string
+	Handlers    []*VMHandler // 按 ID 排序
+	Invocations []*VMInvocation
+}
+
+// isIndirectBranch 判断指令是否为间接跳转（br/blr 及其带认证的变体，不含 ret）
+func isIndirectBranch(d *DecodedInstr) bool {
+	return d.Branch && !d.HasTarget && !d.Return
+}
+
+// FindDispatcher 返回执行次数最多的间接跳转地址及其次数，没有间接跳转时 count 为 0
+func FindDispatcher(tm *TraceManager) (addr uint64, count int, err error) {
+	counts := make(map[uint64]int)
+	err = tm.Scan(func(index int, t *TraceLine) bool {
+		if isIndirectBranch(t.Decode()) {
+			counts[t.Addr]++
+		}
+		return true
+	})
+	for a, n := range counts {
+		if n > count || n == count && a < addr {
+			addr, count = a, n
+		}
+	}
+	return addr, count, err
+}
+
+// AnalyzeVM 以 dispatcher 处的间接跳转为分发器，把 trace 切分为一次次处理函数调用：
+// 分发器每次执行后的下一行是处理函数入口，入口不同的处理函数分别编号
+func AnalyzeVM(tm *TraceManager, dispatcher uint64) (*VM, error) {
+	vm := &VM{Dispatcher: dispatcher}
+	byEntry := make(map[uint64]*VMHandler)
+	var current *VMInvocation
+	pending := false // 上一行是分发器
+	total := 0
+
+	err := tm.Scan(func(index int, t *TraceLine) bool {
+		total = index + 1
+		if pending {
+			pending = false
+			h := byEntry[t.Addr]
+			if h == nil {
+				h = &VMHandler{ID: len(vm.Handlers), Entry: t.Addr}
+				byEntry[t.Addr] = h
+				vm.Handlers = append(vm.Handlers, h)
+			}
+			h.Count++
+			current = &VMInvocation{Handler: h, Start: index, End: -1, Step: t.Step}
+			vm.Invocations = append(vm.Invocations, current)
+		}
+
+		if t.Addr == dispatcher {
+			if vm.DispatchIns == "" {
+				vm.DispatchIns = t.Instr
+			}
+			if current != nil {
+				current.End = index
+				current = nil
+			}
+			pending = true
+			return true
+		}
+
+		if current != nil {
+			h := current.Handler
+			h.Instrs++
+			// 第一次调用时记录开头几条指令作为摘要
+			if h.Count == 1 && !h.previewDone {
+				h.Preview = append(h.Preview, t.Instr)
+				h.previewDone = t.Decode().Branch || len(h.Preview) >= maxHandlerPreview
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		current.End = total
+	}
+	return vm, nil
+}
+
+// InvocationAt 返回包含第 index 行的调用在 Invocations 中的下标，不在任何调用中时返回 -1
+func (vm *VM) InvocationAt(index int) int {
+	i := sort.Search(len(vm.Invocations), func(i int) bool { return vm.Invocations[i].End > index })
+	if i < len(vm.Invocations) && vm.Invocations[i].Start <= index {
+		return i
+	}
+	return -1
+}
+
+// FindHandler 按 ID（"H3" 或 "3"）或入口地址查找处理函数
+func (vm *VM) FindHandler(name string) *VMHandler {
+	for _, h := range vm.Handlers {
+		if strings.EqualFold(name, h.Name()) || name == fmt.Sprint(h.ID) || name == fmt.Sprintf("0x%x", h.Entry) {
+			return h
+		}
+	}
+	return nil
+}
+
+// PreviewText 返回处理函数开头几条指令的摘要
+func (h *VMHandler) PreviewText() string {
+	return strings.Join(h.Preview, "; ")
+}
+
+// Format 列出分发器和按分发次数排序的处理函数
+func (vm *VM) Format() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Dispatcher 0x%x  %s\n", vm.Dispatcher, vm.DispatchIns))
+	sb.WriteString(fmt.Sprintf("%d handlers, %d dispatches\n\n", len(vm.Handlers), len(vm.Invocations)))
+
+	handlers := append([]*VMHandler(nil), vm.Handlers...)
+	sort.SliceStable(handlers, func(i, j int) bool { return handlers[i].Count > handlers[j].Count })
+	for _, h := range handlers {
+		avg := float64(h.Instrs) / float64(h.Count)
+		sb.WriteString(fmt.Sprintf("  %-5s 0x%x  x%-6d %5.1f instrs  %s\n", h.Name(), h.Entry, h.Count, avg, h.PreviewText()))
+	}
+	return sb.String()
+}
+
+// VM 返回（必要时分析）以执行最多的间接跳转为分发器的虚拟机结构，trace 中没有间接跳转时返回错误
+func (tm *TraceManager) VM() (*VM, error) {
+	if tm.vm != nil {
+		return tm.vm, nil
+	}
+	addr, count, err := FindDispatcher(tm)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("no indirect branch in trace")
+	}
+	vm, err := AnalyzeVM(tm, addr)
+	if err != nil {
+		return nil, err
+	}
+	tm.vm = vm
+	return vm, nil
+}
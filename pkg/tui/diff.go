@@ -0,0 +1,190 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/djskncxm/TraceParse/pkg/core"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// diffState 是并排比较界面的状态
+type diffState struct {
+	diff   *core.TraceDiff
+	a, b   *core.TraceManager
+	row    int
+	header *tview.TextView
+	viewA  *tview.TextView
+	viewB  *tview.TextView
+	regs   *tview.TextView
+}
+
+// RunDiff 并排显示两条 trace 的对齐结果，启动时停在第一个分叉处（寄存器或控制流）
+func RunDiff(d *core.TraceDiff, a, b *core.TraceManager) error {
+	// 翻页时会重新加载窗口，解析错误不能写到 tview 占用的终端上
+	a.ErrorLog, b.ErrorLog = nil, nil
+
+	app := tview.NewApplication()
+	s := &diffState{
+		diff:   d,
+		a:      a,
+		b:      b,
+		row:    firstDifference(d),
+		header: NewStatusView(),
+		viewA:  NewLogView("A: " + filepath.Base(a.FileName)),
+		viewB:  NewLogView("B: " + filepath.Base(b.FileName)),
+		regs:   NewRegView(),
+	}
+	s.header.SetTitle("|Diff|")
+	s.regs.SetTitle("|Registers A / B|")
+
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		rows := d.Rows()
+		switch event.Key() {
+		case tcell.KeyRight, tcell.KeyDown:
+			s.row = min(s.row+1, rows-1)
+		case tcell.KeyLeft, tcell.KeyUp:
+			s.row = max(s.row-1, 0)
+		case tcell.KeyPgDn:
+			s.row = min(s.row+20, rows-1)
+		case tcell.KeyPgUp:
+			s.row = max(s.row-20, 0)
+		case tcell.KeyEscape:
+			app.Stop()
+			return nil
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case 'n', 'j':
+				s.row = min(s.row+1, rows-1)
+			case 'p', 'k':
+				s.row = max(s.row-1, 0)
+			case 'd':
+				if r := d.NextDivergence(s.row, true); r >= 0 {
+					s.row = r
+				}
+			case 'D':
+				if r := d.NextDivergence(s.row, false); r >= 0 {
+					s.row = r
+				}
+			case 'f':
+				s.row = firstDifference(d)
+			case 'g':
+				s.row = 0
+			case 'G':
+				s.row = max(rows-1, 0)
+			case 'q', 'Q':
+				app.Stop()
+				return nil
+			default:
+				return event
+			}
+		default:
+			return event
+		}
+		s.update()
+		return nil
+	})
+
+	panes := tview.NewFlex().
+		AddItem(s.viewA, 0, 1, false).
+		AddItem(s.viewB, 0, 1, false)
+	root := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(s.header, 5, 0, false).
+		AddItem(panes, 0, 3, false).
+		AddItem(s.regs, 13, 0, false)
+
+	s.update()
+	return app.SetRoot(root, true).Run()
+}
+
+// firstDifference 返回第一个寄存器差异或控制流分叉所在的行，两者都没有时返回 0
+func firstDifference(d *core.TraceDiff) int {
+	row := d.NextDivergence(-1, true)
+	if r := d.FirstRegDiff; r != nil {
+		if regRow := d.RowOfA(r.A); regRow >= 0 && (row < 0 || regRow < row) {
+			row = regRow
+		}
+	}
+	return max(row, 0)
+}
+
+// update 重新绘制两侧的指令和当前行的寄存器对比
+func (s *diffState) update() {
+	d := s.diff
+	windowSize := 41
+	start := max(s.row-windowSize/2, 0)
+	end := min(start+windowSize, d.Rows())
+	start = max(end-windowSize, 0)
+
+	var sbA, sbB strings.Builder
+	for r := start; r < end; r++ {
+		ia, ib, aligned := d.Row(r)
+		marker := "  "
+		if r == s.row {
+			marker = "[red]▶[-] "
+		}
+		sbA.WriteString(marker + diffLine(s.a, ia, aligned) + "\n")
+		sbB.WriteString(marker + diffLine(s.b, ib, aligned) + "\n")
+	}
+	s.viewA.SetText(sbA.String())
+	s.viewB.SetText(sbB.String())
+
+	ia, ib, aligned := d.Row(s.row)
+	state := "[green]aligned[-]"
+	if !aligned {
+		state = "[red]diverged[-]"
+	}
+	divs := d.Divergences()
+	header := fmt.Sprintf("Row %d/%d  A line %d  B line %d  %s\n", s.row+1, d.Rows(), ia, ib, state)
+	header += fmt.Sprintf("%d divergences | module delta %s, stack delta %s\n", len(divs), core.SignedHex(d.CodeDelta), core.SignedHex(d.StackDelta))
+	header += "[gray]←/→ step  d/D next/prev divergence  f first difference  g/G start/end  q quit[-]"
+	s.header.SetText(header)
+
+	s.regs.SetText(diffRegisters(d, s.a.LineAt(ia), s.b.LineAt(ib)))
+}
+
+// diffLine 格式化一侧的一行，idx 为 -1 时这一侧在分叉中已经没有指令
+func diffLine(tm *core.TraceManager, idx int, aligned bool) string {
+	if idx < 0 {
+		return "[gray]~[-]"
+	}
+	t := tm.LineAt(idx)
+	if t == nil {
+		return fmt.Sprintf("%6d | [gray]Loading...[-]", idx)
+	}
+	line := fmt.Sprintf("%6d | 0x%012x | +0x%-6x | %s", idx, t.Addr, t.Offset, tview.Escape(t.Instr))
+	if !aligned {
+		line = "[yellow]" + line + "[-]"
+	}
+	return line
+}
+
+// diffRegisters 并排列出两侧的寄存器，取值不同（扣除 ASLR 偏移后）的标红
+func diffRegisters(d *core.TraceDiff, ta, tb *core.TraceLine) string {
+	if ta == nil || tb == nil {
+		return "[gray]Only one side has an instruction at this row[-]"
+	}
+	var sb strings.Builder
+	for i := 0; i <= 31; i++ {
+		name, va, vb := fmt.Sprintf("x%-2d", i), uint64(0), uint64(0)
+		if i == 31 {
+			name, va, vb = "sp ", ta.SP, tb.SP
+		} else {
+			va, vb = ta.Regs[i], tb.Regs[i]
+		}
+		cell := fmt.Sprintf("%s 0x%016x / 0x%016x", name, va, vb)
+		if !d.SameValue(va, vb) {
+			cell = "[red]" + cell + "[-]"
+		}
+		sb.WriteString(cell)
+		if i%3 == 2 {
+			sb.WriteString("\n")
+		} else {
+			sb.WriteString("   ")
+		}
+	}
+	return sb.String()
+}
@@ -5,7 +5,7 @@ import (
 	"github.com/djskncxm/TraceParse/pkg/core"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
-	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -26,6 +26,9 @@ type AppState struct {
 	// 新增：BL 和 RW 视图
 	BlView *tview.TextView
 	RwView *tview.TextView
+
+	BacktraceView *tview.TextView
+	ResultView    *tview.TextView
 }
 
 func NewAsmView() *tview.TextView {
@@ -47,6 +50,16 @@ func NewRegView() *tview.TextView {
 	return regView
 }
 
+func NewBacktraceView() *tview.TextView {
+	backtraceView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true).
+		SetWrap(false)
+	backtraceView.SetBorder(true).SetTitle("|Backtrace|")
+	backtraceView.SetBackgroundColor(tcell.ColorDefault)
+	return backtraceView
+}
+
 func NewStatusView() *tview.TextView {
 	statusView := tview.NewTextView().
 		SetDynamicColors(true)
@@ -61,16 +74,61 @@ func NewMemoryView() *tview.TextView {
 		SetScrollable(true)
 	memoryView.SetBorder(true).SetTitle("|Memory|")
 	memoryView.SetBackgroundColor(tcell.ColorDefault)
-	memoryView.SetText("Memory view - Not implemented yet")
+	memoryView.SetText("Memory view - use mem <addr> or x/NFU <expr>")
 	return memoryView
 }
 
+func NewResultView() *tview.TextView {
+	resultView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true).
+		SetWrap(false)
+	resultView.SetBorder(true).SetTitle("|Results|")
+	resultView.SetBackgroundColor(tcell.ColorDefault)
+	return resultView
+}
+
 func NewInputView(state *AppState) *tview.InputField {
 	inputField := tview.NewInputField().
 		SetLabel("Command: ").
 		SetFieldWidth(0).
 		SetFieldBackgroundColor(tcell.ColorDarkSlateGray)
 
+	// ↑/↓ 浏览命令历史
+	historyPos := -1
+	inputField.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		history := state.User.History
+		switch event.Key() {
+		case tcell.KeyUp:
+			if len(history) == 0 {
+				return nil
+			}
+			if historyPos == -1 || historyPos > len(history) {
+				historyPos = len(history)
+			}
+			if historyPos > 0 {
+				historyPos--
+			}
+			inputField.SetText(history[historyPos])
+			return nil
+		case tcell.KeyDown:
+			if historyPos == -1 {
+				return nil
+			}
+			historyPos++
+			if historyPos >= len(history) {
+				historyPos = -1
+				inputField.SetText("")
+			} else {
+				inputField.SetText(history[historyPos])
+			}
+			return nil
+		case tcell.KeyEnter:
+			historyPos = -1
+		}
+		return event
+	})
+
 	inputField.SetDoneFunc(func(key tcell.Key) {
 		if key != tcell.KeyEnter {
 			return
@@ -83,6 +141,7 @@ func NewInputView(state *AppState) *tview.InputField {
 		}
 
 		// 解析命令
+		state.User.Record(cmd)
 		command := state.User.ParseCommand(cmd)
 
 		// 更新显示
@@ -104,6 +163,174 @@ func NewInputView(state *AppState) *tview.InputField {
 	return inputField
 }
 
+// asmRow 是汇编视图中的一行：一条指令，或者一个折叠起来的循环
+type asmRow struct {
+	index int // 指令所在行，折叠的循环为循环的第一行
+	loop  *core.Loop
+}
+
+// end 返回这一行之后的下一条指令
+func (r asmRow) end() int {
+	if r.loop != nil {
+		return r.loop.End
+	}
+	return r.index + 1
+}
+
+// asmRows 以当前行为中心取最多 windowSize 行，折叠的循环只占一行，被过滤掉的指令不显示
+func asmRows(state *AppState, currentIdx, total, windowSize int) []asmRow {
+	rowAt := func(i int) asmRow {
+		if l := state.User.FoldedLoop(i); l != nil {
+			return asmRow{index: l.Start, loop: l}
+		}
+		return asmRow{index: i}
+	}
+	filter := state.User.Filter
+	// prev 和 next 返回 i 之前 / 之后（含 i）的第一个可见行，没有时返回 -1
+	prev := func(i int) int {
+		if i < 0 || filter.Contains(i) {
+			return i
+		}
+		return filter.Prev(i)
+	}
+	next := func(i int) int {
+		if i >= total {
+			return -1
+		}
+		if filter.Contains(i) {
+			return i
+		}
+		return filter.Next(i)
+	}
+
+	cur := rowAt(currentIdx)
+	var before, after []asmRow
+	for i := prev(cur.index - 1); i >= 0 && len(before) < windowSize/2; {
+		r := rowAt(i)
+		before = append(before, r)
+		i = prev(r.index - 1)
+	}
+	for i := next(cur.end()); i >= 0 && len(before)+len(after)+1 < windowSize; {
+		r := rowAt(i)
+		after = append(after, r)
+		i = next(r.end())
+	}
+	// 接近末尾时向前补足
+	for len(before)+len(after)+1 < windowSize {
+		i := cur.index - 1
+		if len(before) > 0 {
+			i = before[len(before)-1].index - 1
+		}
+		if i = prev(i); i < 0 {
+			break
+		}
+		before = append(before, rowAt(i))
+	}
+
+	rows := make([]asmRow, 0, len(before)+len(after)+1)
+	for i := len(before) - 1; i >= 0; i-- {
+		rows = append(rows, before[i])
+	}
+	rows = append(rows, cur)
+	return append(rows, after...)
+}
+
+// formatAsmLine 格式化第 i 条指令
+func formatAsmLine(state *AppState, i, total int) string {
+	inst := state.TraceManager.GetLine(i)
+
+	if inst == nil {
+		// 显示加载状态
+		return fmt.Sprintf("%4d | [gray]Loading...[-]", i+1)
+	}
+
+	// 格式化指令行
+	instr := tview.Escape(inst.Instr)
+	if state.User.Taint.Hit(i) {
+		instr = "[orange]" + instr + "[-]"
+	} else if state.User.Slice.Contains(i) {
+		instr = "[aqua]" + instr + "[-]"
+	}
+	line := fmt.Sprintf("%4d | 0x%012x | 0x%x | %s", inst.Step, inst.Addr, inst.Offset, instr)
+
+	// 写入的寄存器：解码得到的目的寄存器加上值实际发生变化的寄存器（只检查下一条指令是否已加载）
+	// PC 只在控制流不连续时显示
+	nextIdx := i + 1
+	if nextIdx < total {
+		nextInst := state.TraceManager.GetLine(nextIdx)
+		if nextInst != nil {
+			writes := inst.Decode().Writes
+			var changedRegs []string
+			for reg := 0; reg < 31; reg++ {
+				if writes&(1<<uint(reg)) != 0 || inst.Regs[reg] != nextInst.Regs[reg] {
+					changedRegs = append(changedRegs, fmt.Sprintf("x%d", reg))
+				}
+			}
+			if writes&(1<<31) != 0 || inst.SP != nextInst.SP {
+				changedRegs = append(changedRegs, "SP")
+			}
+			if nextInst.Addr != inst.Addr+4 {
+				changedRegs = append(changedRegs, "PC")
+			}
+
+			if len(changedRegs) > 0 {
+				line += fmt.Sprintf(" [gray]→ %s[-]", strings.Join(changedRegs, ", "))
+			}
+		}
+	}
+
+	// 书签
+	if m := state.User.Bookmarks.At(i); m != nil {
+		line += fmt.Sprintf(" [blue]'%s[-]", tview.Escape(m.Name))
+	}
+
+	return line
+}
+
+// formatLoopRow 格式化折叠起来的循环，当前行在循环内时标出所在的迭代
+func formatLoopRow(l *core.Loop, currentIdx int) string {
+	line := fmt.Sprintf("%4d | [fuchsia]▸ %s[-]", l.FirstStep, tview.Escape(l.String()))
+	if l.Contains(currentIdx) {
+		line += fmt.Sprintf(" [yellow]iteration %d/%d[-]", l.Iteration(currentIdx), l.Iterations)
+	}
+	return line
+}
+
+// updateVMView 把汇编视图显示为处理函数调用序列，当前行所在的调用高亮
+func updateVMView(state *AppState, vm *core.VM) {
+	currentIdx := state.TraceManager.CurrentIndex
+	invs := vm.Invocations
+	cur := vm.InvocationAt(currentIdx)
+
+	// 以当前调用为中心，不在任何调用中时以当前行之后的第一次调用为中心
+	center := cur
+	if center < 0 {
+		center = sort.Search(len(invs), func(i int) bool { return invs[i].Start > currentIdx })
+	}
+	windowSize := 51
+	start := max(center-windowSize/2, 0)
+	end := min(start+windowSize, len(invs))
+	start = max(end-windowSize, 0)
+
+	var sb strings.Builder
+	for i := start; i < end; i++ {
+		inv := invs[i]
+		h := inv.Handler
+		line := fmt.Sprintf("%4d | #%-5d [yellow]%-5s[-] 0x%012x | %3d instrs | [gray]%s[-]",
+			inv.Step, i, h.Name(), h.Entry, inv.End-inv.Start, tview.Escape(h.PreviewText()))
+		if i == cur {
+			sb.WriteString(fmt.Sprintf("[red]▶ %s[white]\n", line))
+		} else {
+			sb.WriteString(fmt.Sprintf("  %s\n", line))
+		}
+	}
+
+	header := fmt.Sprintf("[green]VM dispatcher 0x%x | Dispatch %d/%d | %d handlers[white]\n",
+		vm.Dispatcher, cur+1, len(invs), len(vm.Handlers))
+	state.AsmView.SetText(header + sb.String())
+	state.AsmView.ScrollToBeginning()
+}
+
 func UpdateAsmView(state *AppState) {
 	total := state.TraceManager.Total()
 	currentIdx := state.TraceManager.CurrentIndex
@@ -112,66 +339,29 @@ func UpdateAsmView(state *AppState) {
 		state.AsmView.SetText("No instructions loaded")
 		return
 	}
-
-	// 计算显示范围
-	windowSize := 51
-	start := currentIdx - windowSize/2
-	if start < 0 {
-		start = 0
-	}
-	end := start + windowSize
-	if end > total {
-		end = total
-		start = end - windowSize
-		if start < 0 {
-			start = 0
-		}
+	if vm := state.User.VM; vm != nil && state.User.VMView {
+		updateVMView(state, vm)
+		return
 	}
 
 	var sb strings.Builder
-	for i := start; i < end; i++ {
-		inst := state.TraceManager.GetLine(i)
-
-		if inst == nil {
-			// 显示加载状态
-			line := fmt.Sprintf("%4d | [gray]Loading...[-]", i+1)
-			if i == currentIdx {
-				sb.WriteString(fmt.Sprintf("[yellow]▶ %s[white]\n", line))
-			} else {
-				sb.WriteString(fmt.Sprintf("  %s\n", line))
-			}
-			continue
+	windowSize := 51
+	rows := asmRows(state, currentIdx, total, windowSize)
+	for n, r := range rows {
+		// 过滤视图中标出被隐藏的行数
+		if state.User.Filter != nil && n > 0 && rows[n-1].end() < r.index {
+			sb.WriteString(fmt.Sprintf("  [gray]     ⋯ %d hidden[-]\n", r.index-rows[n-1].end()))
 		}
 
-		// 格式化指令行
-		line := fmt.Sprintf("%4d | 0x%012x | 0x%x | %s", inst.Step, inst.Addr, inst.Offset, tview.Escape(inst.Instr))
-
-		// 检查寄存器变化（只检查下一条指令是否已加载）
-		nextIdx := i + 1
-		if nextIdx < total {
-			nextInst := state.TraceManager.GetLine(nextIdx)
-			if nextInst != nil {
-				var changedRegs []string
-				for reg := 0; reg < 31; reg++ {
-					if inst.Regs[reg] != nextInst.Regs[reg] {
-						changedRegs = append(changedRegs, fmt.Sprintf("x%d", reg))
-					}
-				}
-				if inst.SP != nextInst.SP {
-					changedRegs = append(changedRegs, "SP")
-				}
-				if inst.PC != nextInst.PC {
-					changedRegs = append(changedRegs, "PC")
-				}
-
-				if len(changedRegs) > 0 {
-					line += fmt.Sprintf(" [gray]→ %s[-]", strings.Join(changedRegs, ", "))
-				}
-			}
+		var line string
+		if r.loop != nil {
+			line = formatLoopRow(r.loop, currentIdx)
+		} else {
+			line = formatAsmLine(state, r.index, total)
 		}
 
 		// 高亮当前行
-		if i == currentIdx {
+		if r.index <= currentIdx && currentIdx < r.end() {
 			sb.WriteString(fmt.Sprintf("[red]▶ %s[white]\n", line))
 		} else {
 			sb.WriteString(fmt.Sprintf("  %s\n", line))
@@ -181,8 +371,12 @@ func UpdateAsmView(state *AppState) {
 	// 添加页眉信息和加载范围
 	loadedStart := state.TraceManager.LoadedRange[0]
 	loadedEnd := state.TraceManager.LoadedRange[1]
-	header := fmt.Sprintf("[green]Instructions: %d/%d | Loaded: [%d, %d) (%d lines)[white]\n",
+	header := fmt.Sprintf("[green]Instructions: %d/%d | Loaded: [%d, %d) (%d lines)",
 		currentIdx+1, total, loadedStart, loadedEnd, loadedEnd-loadedStart)
+	if f := state.User.Filter; f != nil {
+		header += fmt.Sprintf(" | Filtered: %d visible", len(f.Visible))
+	}
+	header += "[white]\n"
 
 	state.AsmView.SetText(header + sb.String())
 	state.AsmView.ScrollToBeginning()
@@ -193,6 +387,60 @@ func UpdateRegView(state *AppState) {
 	state.RegView.SetText(regInfo)
 }
 
+// UpdateMemoryView 显示影子内存，没有可显示的地址时保留原有内容（帮助信息）
+func UpdateMemoryView(state *AppState) {
+	if info := state.User.GetMemoryInfo(); info != "" {
+		state.MemoryView.SetText(info)
+		state.MemoryView.ScrollToBeginning()
+	}
+}
+
+// UpdateResultView 显示最近一次命令产生的结果列表
+func UpdateResultView(state *AppState) {
+	if state.User.ResultTitle == "" {
+		return
+	}
+	state.ResultView.SetTitle(fmt.Sprintf("|%s|", state.User.ResultTitle))
+	state.ResultView.SetText(state.User.ResultText)
+	state.ResultView.ScrollToBeginning()
+}
+
+func UpdateBacktraceView(state *AppState) {
+	state.BacktraceView.SetText(state.User.GetBacktraceInfo())
+	state.BacktraceView.ScrollToBeginning()
+}
+
+// StartBackgroundAnalysis 在后台依次构建调用栈和区域表，每完成一个就在界面线程中安装并刷新对应面板
+func StartBackgroundAnalysis(state *AppState) {
+	tm, filename := state.TraceManager, state.LoadedFile
+	go func() {
+		cs, err := core.BuildCallStack(tm)
+		state.App.QueueUpdateDraw(func() {
+			// 期间已经加载了别的 trace
+			if state.LoadedFile != filename {
+				return
+			}
+			state.User.SetCallStack(cs, err)
+			UpdateBacktraceView(state)
+		})
+		if err != nil {
+			return
+		}
+
+		rm, err := core.BuildRegionMap(tm, cs)
+		if err != nil {
+			return
+		}
+		state.App.QueueUpdateDraw(func() {
+			if state.LoadedFile != filename {
+				return
+			}
+			state.User.SetRegionMap(rm)
+			UpdateRegView(state)
+		})
+	}()
+}
+
 // 添加自动步进函数
 func StartAutoStep(state *AppState) {
 	go func() {
@@ -211,8 +459,10 @@ func StartAutoStep(state *AppState) {
 							if updated {
 								UpdateAsmView(state)
 								UpdateRegView(state)
+								UpdateBacktraceView(state)
 								UpdateRwView(state)
 								UpdateBlView(state)
+								UpdateMemoryView(state)
 							}
 							if message != "" {
 								state.StatusView.SetText(message)
@@ -244,6 +494,7 @@ func UpdateDisplay(state *AppState, command *core.Command) {
 	if state.TraceManager.Total() == 0 {
 		state.AsmView.SetText("No instructions loaded")
 		state.RegView.SetText("")
+		state.BacktraceView.SetText("")
 		state.BlView.SetText("")
 		state.RwView.SetText("")
 		state.StatusView.SetText("Load instructions using: load <filename>")
@@ -265,11 +516,21 @@ func UpdateDisplay(state *AppState, command *core.Command) {
 	// 更新各个视图
 	UpdateAsmView(state)
 	UpdateRegView(state)
+	UpdateBacktraceView(state)
 	UpdateBlView(state)
 	UpdateRwView(state)
+	UpdateMemoryView(state)
+	UpdateResultView(state)
 	UpdateStatusView(state)
 }
 
+// RestoreSession 在 trace 加载完成后恢复会话并刷新显示
+func RestoreSession(state *AppState, session *core.Session) error {
+	err := state.User.ApplySession(session)
+	UpdateDisplay(state, nil)
+	return err
+}
+
 // LoadInstructionsFromFile 加载指令文件和相关日志
 func LoadInstructionsFromFile(filename string, state *AppState) error {
 	state.LoadedFile = filename
@@ -280,15 +541,8 @@ func LoadInstructionsFromFile(filename string, state *AppState) error {
 		return err
 	}
 
-	// 尝试加载 BL 和 RW 日志
-	dir := filepath.Dir(filename)
-	baseName := filepath.Base(filename)
-
-	// 根据主文件名推断日志文件名
-	if strings.HasSuffix(baseName, "code.log") {
-		blFile := filepath.Join(dir, "bl.log")
-		rwFile := filepath.Join(dir, "rw.log")
-
+	// 尝试加载 BL 和 RW 日志（根据主文件名推断日志文件名）
+	if blFile, rwFile, ok := core.CompanionLogs(filename); ok {
 		// 加载 BL 日志
 		if err := state.TraceManager.LogManager.LoadBLLog(blFile); err != nil {
 			state.StatusView.SetText(fmt.Sprintf("Warning: Could not load BL log: %v", err))
@@ -305,10 +559,17 @@ func LoadInstructionsFromFile(filename string, state *AppState) error {
 	}
 
 	// 重置用户状态
-	state.User.LastCommand = nil
-	state.User.RepeatCount = 0
-	state.User.AutoStep = false
-	state.User.RegDetector = core.NewRegisterChangeDetector()
+	state.User.Reset()
+
+	// 读取该 trace 的书签
+	bookmarks, err := core.LoadBookmarks(filename)
+	if err != nil {
+		state.StatusView.SetText(fmt.Sprintf("Warning: Could not load bookmarks: %v", err))
+	}
+	state.User.Bookmarks = bookmarks
+
+	// 需要扫描整个 trace 的分析放到后台
+	StartBackgroundAnalysis(state)
 
 	// 更新显示
 	UpdateDisplay(state, nil)
@@ -319,7 +580,7 @@ func UpdateStatusView(state *AppState) {
 	statusInfo := state.User.GetStatusInfo()
 
 	// 添加帮助提示
-	helpText := `[gray]Commands: n/p, space=repeat, ←/→=prev/next, q=quit[-]`
+	helpText := `[gray]Commands: n/p, /pat ?pat N, space=repeat, ←/→=prev/next, q=quit[-]`
 
 	state.StatusView.SetText(statusInfo + "\n" + helpText)
 }